@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+	"encoding/json"
+
+	"net/http"
+	"goji.io/middleware"
+	"goji.io/pattern"
+)
+
+/* Constants */
+
+//Text logged instead of the value of a redacted parameter
+const redactedValue = "[REDACTED]"
+
+//Routes of the orchestrator probes and the metrics scraper, which are not logged
+var unloggedPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz": true,
+	"/version": true,
+	"/metrics": true,
+}
+
+/* Types */
+
+//accessLogEntry is the line logged for a request
+type accessLogEntry struct{
+	Time string `json:"time"`
+	RequestID string `json:"request_id"`
+	Method string `json:"method"`
+	Path string `json:"path"`
+	Pattern string `json:"pattern"`
+	Params map[string]string `json:"params,omitempty"`
+	Query map[string]string `json:"query,omitempty"`
+	Status int `json:"status"`
+	Bytes int `json:"bytes"`
+	LatencyMs float64 `json:"latency_ms"`
+	RemoteAddress string `json:"remote_addr"`
+}
+
+//responseRecorder keeps the status and the number of bytes written in a response
+type responseRecorder struct{
+	http.ResponseWriter
+	Status int
+	Bytes int
+}
+
+//WriteHeader records the status of the response
+func (recorder *responseRecorder) WriteHeader(status int){
+	if recorder.Status == 0 {
+		recorder.Status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+//Write records the number of bytes of the response
+func (recorder *responseRecorder) Write(data []byte) (int, error){
+	if recorder.Status == 0 {
+		recorder.Status = http.StatusOK
+	}
+	written, writeError := recorder.ResponseWriter.Write(data)
+	recorder.Bytes += written
+	return written, writeError
+}
+
+//Flush sends the buffered response to the client when the wrapped writer can do it
+func (recorder *responseRecorder) Flush(){
+	if flusher, canFlush := recorder.ResponseWriter.(http.Flusher); canFlush {
+		flusher.Flush()
+	}
+}
+
+/* Middleware */
+
+//accessLog logs a JSON line for each request, except the probes, whatever the log level is. Only a sampleRate fraction
+//of the successful requests is logged while every failed request, with a 4xx or 5xx status, is, and the values
+//of the path and query parameters with the redacted names are hidden
+func accessLog(sampleRate float64, redacted []string) func(http.Handler) http.Handler{
+	redactedNames := map[string]bool{}
+	for _, name := range redacted {
+		redactedNames[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	return func(next http.Handler) http.Handler{
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+			if unloggedPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			recorder := &responseRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(recorder, r)
+
+			if recorder.Status == 0 {
+				recorder.Status = http.StatusOK
+			}
+			if recorder.Status < http.StatusBadRequest && rand.Float64() >= sampleRate {
+				return
+			}
+
+			entry := accessLogEntry{
+				Time: start.UTC().Format(time.RFC3339Nano),
+				RequestID: requestID(r),
+				Method: r.Method,
+				Path: r.URL.Path,
+				Pattern: matchedPattern(r),
+				Params: map[string]string{},
+				Query: map[string]string{},
+				Status: recorder.Status,
+				Bytes: recorder.Bytes,
+				LatencyMs: float64(time.Since(start)) / float64(time.Millisecond),
+				RemoteAddress: r.RemoteAddr,
+			}
+
+			//Path parameters bound by the matched pattern
+			if variables, hasVariables := r.Context().Value(pattern.AllVariables).(map[pattern.Variable]interface{}); hasVariables {
+				for name, value := range variables {
+					entry.Params[string(name)] = redact(string(name), fmt.Sprint(value), redactedNames)
+				}
+			}
+
+			for name, values := range r.URL.Query() {
+				entry.Query[name] = redact(name, strings.Join(values, ","), redactedNames)
+			}
+
+			jsonEntry, _ := json.Marshal(entry)
+			logLine(string(jsonEntry))
+		})
+	}
+}
+
+//matchedPattern gives the goji pattern that matched the request, or an empty text when no route matched
+func matchedPattern(r *http.Request) string{
+	matched := middleware.Pattern(r.Context())
+	if matched == nil {
+		return ""
+	}
+
+	if stringer, isStringer := matched.(fmt.Stringer); isStringer {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%T", matched)
+}
+
+//redact hides the value of a parameter when its name is redacted
+func redact(name string, value string, redactedNames map[string]bool) string{
+	if redactedNames[strings.ToLower(name)] {
+		return redactedValue
+	}
+	return value
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"net/http"
+)
+
+/* Constants */
+
+//Prefixes of the routes of each version of the API. The routes without a prefix are the ones of the version 1
+const (
+	apiV1Prefix = "/v1"
+	apiV2Prefix = "/v2"
+)
+
+/* Route Wrappers */
+
+//deprecatedRoute marks the responses of a route of the version 1 as deprecated. They have the Deprecation header,
+//the Sunset header with the date when the version 1 stops being served and a link to the same route in the version 2
+func deprecatedRoute(sunset time.Time, handler http.HandlerFunc) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		successor := apiV2Prefix + strings.TrimPrefix(r.URL.Path, apiV1Prefix)
+
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		w.Header().Add("Link", "<" + successor + ">; rel=\"successor-version\"")
+
+		handler(w, r)
+	})
+}
+
+/* Version Functions */
+
+//apiVersion gives the version of the API asked by the request, from the prefix of its path
+func apiVersion(r *http.Request) int{
+	if r.URL.Path == apiV2Prefix || strings.HasPrefix(r.URL.Path, apiV2Prefix + "/") {
+		return 2
+	}
+	return 1
+}
+
+//apiPrefix gives the prefix of the routes of the version asked by the request, to build links to other routes
+func apiPrefix(r *http.Request) string{
+	for _, prefix := range []string{apiV1Prefix, apiV2Prefix} {
+		if strings.HasPrefix(r.URL.Path, prefix + "/") {
+			return prefix
+		}
+	}
+	return ""
+}
+
+//unversionedPattern gives a route pattern without the prefix of its version
+func unversionedPattern(routePattern string) string{
+	for _, prefix := range []string{apiV1Prefix, apiV2Prefix} {
+		if strings.HasPrefix(routePattern, prefix + "/") {
+			return strings.TrimPrefix(routePattern, prefix)
+		}
+	}
+	return routePattern
+}
+
+//documentV2 wraps the value of a response in the document of the version 2, with its data, meta and links.
+//The self link is the URL of the request unless another one is given in the links.
+//The values of the version 1 are converted to the types of the version 2, which have snake_case fields
+func documentV2(r *http.Request, value interface{}, links map[string]string) DocumentV2{
+	document := DocumentV2{
+		Meta: MetaV2{APIVersion: 2, RequestID: requestID(r)},
+		Links: LinksV2{Self: r.URL.RequestURI(), Next: links["next"], Prev: links["prev"]},
+	}
+	if self, hasSelf := links["self"]; hasSelf {
+		document.Links.Self = self
+	}
+
+	switch typed := value.(type) {
+	case Song:
+		document.Data = songV2(typed)
+
+	case SongsList:
+		songs := make([]SongV2, len(typed.Songs))
+		for index, song := range typed.Songs {
+			songs[index] = songV2(song)
+		}
+		document.Data = songs
+		document.Meta.Total = &typed.Total
+
+	case SearchResultsList:
+		results := make([]SearchResultV2, len(typed.Results))
+		for index, result := range typed.Results {
+			results[index] = searchResultV2(result)
+		}
+		document.Data = results
+		document.Meta.Total = &typed.Total
+
+	case Genre:
+		document.Data = genreV2(typed)
+
+	case GenresList:
+		genres := make([]GenreV2, len(typed.Genres))
+		for index, genre := range typed.Genres {
+			genres[index] = genreV2(genre)
+		}
+		total := len(genres)
+		document.Data = genres
+		document.Meta.Total = &total
+
+	default:
+		document.Data = value
+	}
+
+	return document
+}
+
+//songV2 converts a song to the version 2
+func songV2(song Song) SongV2{
+	return SongV2(song)
+}
+
+//searchResultV2 converts a search result to the version 2
+func searchResultV2(result SearchResult) SearchResultV2{
+	return SearchResultV2{
+		SongV2: songV2(result.Song),
+		Score: result.Score,
+		Highlights: SongHighlightsV2(result.Highlights),
+	}
+}
+
+//genreV2 converts a genre to the version 2
+func genreV2(genre Genre) GenreV2{
+	return GenreV2{
+		Name: genre.Genre,
+		NumberOfSongs: genre.NumberOfSongs,
+		TotalLength: genre.TotalLength,
+	}
+}
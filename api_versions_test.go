@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+	"encoding/json"
+
+	"net/http"
+	"net/http/httptest"
+)
+
+/* API Versions Tests */
+
+func TestDocumentV2(t *testing.T){
+	songs := SongsList{
+		Songs: []Song{{ID: 3, Artist: "The Beatles", Song: "Help!", Genre: "Rock", Length: 138}},
+		Total: 5,
+	}
+
+	tests := []struct{
+		name string
+		path string
+		value interface{}
+		links map[string]string
+		document string
+	}{
+		{
+			name: "list with next and prev links", path: "/v2/songs?limit=1&offset=2", value: songs,
+			links: map[string]string{"next": "/v2/songs?limit=1&offset=3", "prev": "/v2/songs?limit=1&offset=1"},
+			document: `{"data":[{"id":3,"artist":"The Beatles","song":"Help!","genre":"Rock","length":138}],` +
+				`"meta":{"api_version":2,"request_id":"abc","total":5},` +
+				`"links":{"self":"/v2/songs?limit=1\u0026offset=2","next":"/v2/songs?limit=1\u0026offset=3","prev":"/v2/songs?limit=1\u0026offset=1"}}`,
+		},
+		{
+			name: "list with another self link", path: "/v2/songs?after=abc", value: SongsList{Total: 5},
+			links: map[string]string{"self": "/v2/songs?limit=1&offset=4"},
+			document: `{"data":[],"meta":{"api_version":2,"request_id":"abc","total":5},"links":{"self":"/v2/songs?limit=1\u0026offset=4"}}`,
+		},
+		{
+			name: "single song", path: "/v2/songs/3", value: songs.Songs[0],
+			document: `{"data":{"id":3,"artist":"The Beatles","song":"Help!","genre":"Rock","length":138},` +
+				`"meta":{"api_version":2,"request_id":"abc"},"links":{"self":"/v2/songs/3"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, "abc"))
+
+		//The documents are written with json.Marshal, which escapes the & of the links
+		document, _ := json.Marshal(documentV2(r, test.value, test.links))
+		if string(document) != test.document {
+			t.Errorf("%s: the document is\n%s\n%s expected", test.name, document, test.document)
+		}
+	}
+}
+
+func TestErrorDocument(t *testing.T){
+	tests := []struct{
+		path string
+		document string
+	}{
+		{"/v2/songs/9", `{"error":{"code":"not_found","message":"Song not found: 9"},"meta":{"api_version":2,"request_id":"abc"}}`},
+		{"/v1/songs/9", `{"Error":{"Code":"not_found","Message":"Song not found: 9","RequestID":"abc"}}`},
+		{"/songs/9", `{"Error":{"Code":"not_found","Message":"Song not found: 9","RequestID":"abc"}}`},
+	}
+
+	for _, test := range tests {
+		clientError := newNotFoundError("Song not found: 9").(*apiError)
+		if document := errorDocument(httptest.NewRequest("GET", test.path, nil), clientError, "abc"); string(document) != test.document {
+			t.Errorf("the error document of %s is\n%s\n%s expected", test.path, document, test.document)
+		}
+	}
+}
+
+func TestDeprecatedRoute(t *testing.T){
+	sunset := time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)
+	handler := deprecatedRoute(sunset, func(w http.ResponseWriter, r *http.Request){
+		w.Header().Add("Link", "</songs?offset=10>; rel=\"next\"")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct{
+		path string
+		successor string
+	}{
+		{"/v1/songs/3", "</v2/songs/3>; rel=\"successor-version\""},
+		{"/songs/genre/Rock", "</v2/songs/genre/Rock>; rel=\"successor-version\""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+
+		if w.Code != http.StatusOK || w.Header().Get("Deprecation") != "true" || w.Header().Get("Sunset") != "Wed, 30 Jun 2027 00:00:00 GMT" {
+			t.Errorf("%s got the status %d, the Deprecation %q and the Sunset %q", test.path, w.Code, w.Header().Get("Deprecation"), w.Header().Get("Sunset"))
+		}
+
+		//The links of the handler are kept after the successor
+		links := w.Header()["Link"]
+		if len(links) != 2 || links[0] != test.successor {
+			t.Errorf("%s got the links %v, %s first expected", test.path, links, test.successor)
+		}
+	}
+}
+
+func TestAPIVersion(t *testing.T){
+	tests := []struct{
+		path string
+		version int
+		prefix string
+	}{
+		{"/songs", 1, ""},
+		{"/v1/songs", 1, apiV1Prefix},
+		{"/v2/songs", 2, apiV2Prefix},
+		{"/v2", 2, ""},
+		{"/v2songs", 1, ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if version, prefix := apiVersion(r), apiPrefix(r); version != test.version || prefix != test.prefix {
+			t.Errorf("%s has the version %d and the prefix %q, %d and %q expected", test.path, version, prefix, test.version, test.prefix)
+		}
+	}
+
+	if routePattern := unversionedPattern("/v2/songs/:id"); routePattern != "/songs/:id" {
+		t.Errorf("the pattern without its version is %s, /songs/:id expected", routePattern)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"net/http"
+	"database/sql"
+)
+
+/* Constants */
+
+//Roles of the API keys, each one can do everything that the previous ones can
+const (
+	roleReader = "reader"
+	roleEditor = "editor"
+	roleAdmin = "admin"
+)
+
+//apiKeyRoles lists the roles from the least to the most powerful
+var apiKeyRoles = []string{roleReader, roleEditor, roleAdmin}
+
+//Text that starts every API key, so they are easy to find in config files and logs
+const apiKeyStart = "bv_"
+
+//Routes that are answered without an API key, the probes of the orchestrator
+var publicRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz": true,
+	"/version": true,
+}
+
+//Routes that need the admin role, the rest need the reader role to read and the editor role to write
+var adminRoutes = map[string]bool{
+	"/metrics": true,
+	"/debug/requests": true,
+	"/debug/events": true,
+}
+
+/* Types */
+
+//apiKey is a key that gives access to the API with a role. Only the hash of the key is stored
+type apiKey struct{
+	ID int
+	Name string
+	Prefix string
+	Role string
+	CreatedAt string
+	RevokedAt string
+}
+
+//apiKeyContextKey is the key of the API key of a request in its context
+type apiKeyContextKey struct{}
+
+/* Middleware */
+
+//authenticate checks the API key of each request, sent as a bearer token in the Authorization header or in the X-API-Key header.
+//Requests without a valid key get a 401 error, and requests whose key does not have the role needed by the matched route get a 403 error
+func (s *server) authenticate(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		role := requiredRole(r.Method, matchedPattern(r))
+		if role == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		secret := requestAPIKey(r)
+		if secret == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, r, newUnauthorizedError("An API key is required"))
+			return
+		}
+
+		key, keyError := findAPIKeyByHashDB(r.Context(), s.database, hashAPIKey(secret))
+		if keyError == sql.ErrNoRows {
+			w.Header().Set("WWW-Authenticate", "Bearer error=\"invalid_token\"")
+			writeError(w, r, newUnauthorizedError("The API key is not valid or it was revoked"))
+			return
+		}
+		if keyError != nil {
+			writeError(w, r, keyError)
+			return
+		}
+
+		if roleIndex(key.Role) < roleIndex(role) {
+			writeError(w, r, newForbiddenError("The API key " + key.Name + " needs the " + role + " role"))
+			return
+		}
+
+		traceEvent(r.Context(), "API key %d %s with the %s role", key.ID, key.Name, key.Role)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	})
+}
+
+/* Auth Functions */
+
+//requiredRole gives the role needed by the route with the given method and pattern, or an empty text for the public routes
+func requiredRole(method string, routePattern string) string{
+	switch {
+	case publicRoutes[routePattern]:
+		return ""
+	case adminRoutes[routePattern]:
+		return roleAdmin
+	case method == http.MethodGet || method == http.MethodHead:
+		return roleReader
+	}
+	return roleEditor
+}
+
+//requestAPIKey gives the API key sent in the request, or an empty text when there is none
+func requestAPIKey(r *http.Request) string{
+	if authorization := r.Header.Get("Authorization"); len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+//newAPIKey generates a new API key and gives it with its prefix, which identifies the key without revealing it
+func newAPIKey() (string, string){
+	prefix := randomHex(4)
+	return apiKeyStart + prefix + "_" + randomHex(16), prefix
+}
+
+//hashAPIKey gives the SHA-256 hash of the key stored in the database. The keys are long and random,
+//so a fast hash is enough and the key of each request can be found by its hash
+func hashAPIKey(key string) string{
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+//roleIndex gives the index of the role in apiKeyRoles, or -1 for an unknown role
+func roleIndex(role string) int{
+	for index, known := range apiKeyRoles {
+		if role == known {
+			return index
+		}
+	}
+	return -1
+}
+
+/* Command */
+
+//apikeyCommand runs the apikey command given in the arguments: create <name> <role>, revoke <prefix or ID> or list.
+//It gives the exit status of the command
+func apikeyCommand(database *sql.DB, args []string) int{
+	if len(args) == 0 {
+		fmt.Println("Usage: BeenVerified apikey create <name> <" + strings.Join(apiKeyRoles, "|") + ">|revoke <prefix or ID>|list")
+		return 2
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "create":
+		if len(args) != 3 || strings.TrimSpace(args[1]) == "" {
+			fmt.Println("Usage: BeenVerified apikey create <name> <" + strings.Join(apiKeyRoles, "|") + ">")
+			return 2
+		}
+		if roleIndex(args[2]) < 0 {
+			fmt.Println("Unknown role: " + args[2] + ", it has to be one of " + strings.Join(apiKeyRoles, ", "))
+			return 2
+		}
+
+		key, prefix := newAPIKey()
+		id, insertError := insertAPIKeyDB(ctx, database, strings.TrimSpace(args[1]), prefix, hashAPIKey(key), args[2])
+		if insertError != nil {
+			fmt.Println("Something went wrong creating the API key")
+			fmt.Println(insertError)
+			return 1
+		}
+
+		//The key is only shown once, the database keeps its hash
+		fmt.Printf("Created the API key %d with the %s role, keep it now since it can not be shown again:\n%s\n", id, args[2], key)
+
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Println("Usage: BeenVerified apikey revoke <prefix or ID>")
+			return 2
+		}
+
+		key := strings.TrimPrefix(args[1], apiKeyStart)
+		revoked, revokeError := revokeAPIKeyDB(ctx, database, key)
+		if revokeError != nil {
+			fmt.Println("Something went wrong revoking the API key")
+			fmt.Println(revokeError)
+			return 1
+		}
+		if revoked == 0 {
+			fmt.Println("API key not found or already revoked: " + args[1])
+			return 1
+		}
+		fmt.Printf("Revoked %d API keys\n", revoked)
+
+	case "list":
+		rows, rowsError := findAllAPIKeysDB(ctx, database)
+		if rowsError != nil {
+			fmt.Println("Something went wrong reading the API keys")
+			fmt.Println(rowsError)
+			return 1
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			key := apiKey{}
+			if scanError := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.Role, &key.CreatedAt, &key.RevokedAt); scanError != nil {
+				fmt.Println("Something went wrong reading the API keys")
+				fmt.Println(scanError)
+				return 1
+			}
+
+			state := "active"
+			if key.RevokedAt != "" {
+				state = "revoked at " + key.RevokedAt
+			}
+			fmt.Printf("%4d  %-12s %-24s %-7s created at %s, %s\n", key.ID, apiKeyStart + key.Prefix, key.Name, key.Role, key.CreatedAt, state)
+		}
+		if rowsError := rows.Err(); rowsError != nil {
+			fmt.Println("Something went wrong reading the API keys")
+			fmt.Println(rowsError)
+			return 1
+		}
+
+	default:
+		fmt.Println("Unknown apikey command: " + args[0])
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"path/filepath"
+
+	"net/http"
+	"net/http/httptest"
+	"database/sql"
+
+	"goji.io"
+	"goji.io/pat"
+)
+
+/* Auth Tests */
+
+func TestRequiredRole(t *testing.T){
+	tests := []struct{
+		method string
+		pattern string
+		role string
+	}{
+		{"GET", "/healthz", ""},
+		{"GET", "/readyz", ""},
+		{"GET", "/version", ""},
+		{"GET", "/songs", roleReader},
+		{"HEAD", "/songs/:id", roleReader},
+		{"POST", "/songs", roleEditor},
+		{"PUT", "/songs/:id", roleEditor},
+		{"DELETE", "/songs/:id", roleEditor},
+		{"GET", "/metrics", roleAdmin},
+		{"GET", "/debug/requests", roleAdmin},
+		{"GET", "/debug/events", roleAdmin},
+	}
+
+	for _, test := range tests {
+		if role := requiredRole(test.method, test.pattern); role != test.role {
+			t.Errorf("requiredRole(%s, %s) is %q, %q expected", test.method, test.pattern, role, test.role)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T){
+	database := newTestDatabase(t)
+	ctx := context.Background()
+
+	//The keys of each role, and a revoked one that had the admin role. Their prefixes are only digits,
+	//so revoking the last one by its prefix must not revoke the key whose ID is the same number
+	keys := map[string]string{
+		roleReader: "bv_00000002_reader",
+		roleEditor: "bv_00000003_editor",
+		roleAdmin: "bv_00000004_admin",
+		"revoked": "bv_00000001_revoked",
+	}
+	for _, role := range []string{roleReader, roleEditor, roleAdmin, "revoked"} {
+		keyRole := role
+		if role == "revoked" {
+			keyRole = roleAdmin
+		}
+		if _, insertError := insertAPIKeyDB(ctx, database, role, strings.Split(keys[role], "_")[1], hashAPIKey(keys[role]), keyRole); insertError != nil {
+			t.Fatal(insertError)
+		}
+	}
+	if revoked, revokeError := revokeAPIKeyDB(ctx, database, "00000001"); revokeError != nil || revoked != 1 {
+		t.Fatalf("revoking the key by its prefix revoked %d keys with the error %v, 1 expected", revoked, revokeError)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request){ w.WriteHeader(http.StatusOK) }
+	mux := goji.NewMux()
+	mux.Use(newServer(database).authenticate)
+	mux.HandleFunc(pat.Get("/healthz"), ok)
+	mux.HandleFunc(pat.Get("/songs"), ok)
+	mux.HandleFunc(pat.Post("/songs"), ok)
+	mux.HandleFunc(pat.Delete("/songs/:id"), ok)
+	mux.HandleFunc(pat.Get("/metrics"), ok)
+
+	tests := []struct{
+		method string
+		path string
+		key string
+		status int
+	}{
+		{"GET", "/healthz", "", http.StatusOK},
+		{"GET", "/healthz", "bv_unknown", http.StatusOK},
+		{"GET", "/songs", "", http.StatusUnauthorized},
+		{"GET", "/songs", "bv_unknown", http.StatusUnauthorized},
+		{"GET", "/songs", keys["revoked"], http.StatusUnauthorized},
+		{"GET", "/metrics", keys["revoked"], http.StatusUnauthorized},
+		{"GET", "/songs", keys[roleReader], http.StatusOK},
+		{"HEAD", "/songs", keys[roleReader], http.StatusOK},
+		{"POST", "/songs", keys[roleReader], http.StatusForbidden},
+		{"DELETE", "/songs/1", keys[roleReader], http.StatusForbidden},
+		{"GET", "/metrics", keys[roleReader], http.StatusForbidden},
+		{"GET", "/songs", keys[roleEditor], http.StatusOK},
+		{"POST", "/songs", keys[roleEditor], http.StatusOK},
+		{"DELETE", "/songs/1", keys[roleEditor], http.StatusOK},
+		{"GET", "/metrics", keys[roleEditor], http.StatusForbidden},
+		{"GET", "/songs", keys[roleAdmin], http.StatusOK},
+		{"POST", "/songs", keys[roleAdmin], http.StatusOK},
+		{"GET", "/metrics", keys[roleAdmin], http.StatusOK},
+	}
+
+	for _, test := range tests {
+		//The key is sent in each of the two headers
+		for _, header := range []string{"Authorization", "X-API-Key"} {
+			r := httptest.NewRequest(test.method, test.path, nil)
+			if test.key != "" && header == "Authorization" {
+				r.Header.Set(header, "Bearer " + test.key)
+			} else if test.key != "" {
+				r.Header.Set(header, test.key)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("%s %s with the key %q in %s got the status %d, %d expected", test.method, test.path, test.key, header, w.Code, test.status)
+			}
+			if w.Code == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Bearer") {
+				t.Errorf("%s %s with the key %q got the status 401 without WWW-Authenticate", test.method, test.path, test.key)
+			}
+		}
+	}
+}
+
+func TestRequestAPIKey(t *testing.T){
+	tests := []struct{
+		authorization string
+		apiKey string
+		key string
+	}{
+		{"Bearer bv_1", "", "bv_1"},
+		{"bearer  bv_1 ", "", "bv_1"},
+		{"Basic dXNlcjpwYXNz", "bv_2", "bv_2"},
+		{"", " bv_2 ", "bv_2"},
+		{"Bearer bv_1", "bv_2", "bv_1"},
+		{"", "", ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/songs", nil)
+		r.Header.Set("Authorization", test.authorization)
+		r.Header.Set("X-API-Key", test.apiKey)
+
+		if key := requestAPIKey(r); key != test.key {
+			t.Errorf("the key of Authorization %q and X-API-Key %q is %q, %q expected", test.authorization, test.apiKey, key, test.key)
+		}
+	}
+}
+
+func TestNewAPIKey(t *testing.T){
+	key, prefix := newAPIKey()
+	if !strings.HasPrefix(key, apiKeyStart + prefix + "_") || len(prefix) != 8 || len(key) != len(apiKeyStart) + 8 + 1 + 32 {
+		t.Errorf("the key %q with the prefix %q does not have the bv_<prefix>_<secret> form", key, prefix)
+	}
+	if other, _ := newAPIKey(); other == key {
+		t.Errorf("two new keys are the same %q", key)
+	}
+
+	if hash := hashAPIKey("bv_0123abcd_secret"); hash != "ff408be2ae463a7b59da292ae61d52e41a2471f3aecc400252fcded23d35de47" {
+		t.Errorf("the hash of the key is %s, its SHA-256 expected", hash)
+	}
+}
+
+func TestAPIKeyCommand(t *testing.T){
+	database := newTestDatabase(t)
+
+	tests := []struct{
+		args []string
+		status int
+	}{
+		{[]string{}, 2},
+		{[]string{"create", "ci"}, 2},
+		{[]string{"create", " ", roleReader}, 2},
+		{[]string{"create", "ci", "owner"}, 2},
+		{[]string{"create", "ci", roleReader}, 0},
+		{[]string{"create", "deploy", roleEditor}, 0},
+		{[]string{"list"}, 0},
+		{[]string{"revoke"}, 2},
+		{[]string{"revoke", "1"}, 0},
+		{[]string{"revoke", "1"}, 1},
+		{[]string{"revoke", "bv_unknown"}, 1},
+		{[]string{"rotate"}, 2},
+	}
+
+	for _, test := range tests {
+		if status := apikeyCommand(database, test.args); status != test.status {
+			t.Errorf("apikey %v gave the exit status %d, %d expected", test.args, status, test.status)
+		}
+	}
+
+	//The second key is still active and can be revoked by its prefix
+	key, keyError := findActiveAPIKeyByName(database, "deploy")
+	if keyError != nil {
+		t.Fatal(keyError)
+	}
+	if status := apikeyCommand(database, []string{"revoke", apiKeyStart + key.Prefix}); status != 0 {
+		t.Errorf("revoking the key by its prefix gave the exit status %d, 0 expected", status)
+	}
+}
+
+//newTestDatabase creates a migrated database in a temporary folder of the test
+func newTestDatabase(t *testing.T) *sql.DB{
+	database, databaseError := initDatabase(filepath.Join(t.TempDir(), "test.db"), time.Second, 1)
+	if databaseError != nil {
+		t.Fatal(databaseError)
+	}
+	t.Cleanup(func(){ database.Close() })
+
+	if _, migrateError := migrateUp(database, false); migrateError != nil {
+		t.Fatal(migrateError)
+	}
+	return database
+}
+
+//findActiveAPIKeyByName gets the active API key with the given name, to know the prefix made by the apikey command
+func findActiveAPIKeyByName(database *sql.DB, name string) (apiKey, error){
+	key := apiKey{}
+	keyError := database.QueryRow("SELECT ID, name, prefix, role FROM api_keys WHERE name = ? AND revoked_at IS NULL", name).Scan(
+		&key.ID, &key.Name, &key.Prefix, &key.Role)
+	return key, keyError
+}
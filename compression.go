@@ -0,0 +1,183 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"compress/gzip"
+	"compress/zlib"
+
+	"net/http"
+)
+
+/* Types */
+
+//compressor compresses the body of a response, it is a *gzip.Writer or a *zlib.Writer
+type compressor interface{
+	Write(data []byte) (int, error)
+	Flush() error
+	Close() error
+}
+
+//compressedResponse compresses the body of a response with the encoding accepted by the client.
+//The start of the body is kept until it reaches the minimum size, so the small bodies are sent as they are
+type compressedResponse struct{
+	http.ResponseWriter
+	encoding string
+	minSize int
+
+	status int
+	buffer []byte
+	started bool
+	compressor compressor
+}
+
+/* Middleware */
+
+//compressResponses compresses the bodies of the responses with gzip or deflate, as accepted by the client in the Accept-Encoding header,
+//when they have at least minSize bytes. The responses that are flushed before reaching that size are compressed too,
+//they are streamed. The responses to HEAD requests and the responses without a body, like the status 304, are never compressed
+func compressResponses(minSize int) func(http.Handler) http.Handler{
+	return func(next http.Handler) http.Handler{
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			response := &compressedResponse{ResponseWriter: w, encoding: encoding, minSize: minSize}
+			defer response.finish()
+
+			next.ServeHTTP(response, r)
+		})
+	}
+}
+
+/* Compression Functions */
+
+//WriteHeader keeps the status until the body shows if it is compressed, the statuses without a body are sent right away
+func (response *compressedResponse) WriteHeader(status int){
+	if response.started || response.status != 0 {
+		return
+	}
+
+	response.status = status
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		response.start(false)
+	}
+}
+
+//Write compresses the body once it reaches the minimum size, and keeps it until then
+func (response *compressedResponse) Write(data []byte) (int, error){
+	if !response.started {
+		response.buffer = append(response.buffer, data...)
+		if len(response.buffer) >= response.minSize {
+			if startError := response.start(true); startError != nil {
+				return 0, startError
+			}
+		}
+		return len(data), nil
+	}
+
+	if response.compressor != nil {
+		return response.compressor.Write(data)
+	}
+	return response.ResponseWriter.Write(data)
+}
+
+//Flush sends the part of the body written so far. A flushed body is streamed, so it is compressed even when it is still small
+func (response *compressedResponse) Flush(){
+	if !response.started {
+		response.start(true)
+	}
+	if response.compressor != nil {
+		response.compressor.Flush()
+	}
+	if flusher, canFlush := response.ResponseWriter.(http.Flusher); canFlush {
+		flusher.Flush()
+	}
+}
+
+//start sends the status and the kept start of the body, compressed when asked and when the response is not encoded yet
+func (response *compressedResponse) start(compress bool) error{
+	response.started = true
+	if response.status == 0 {
+		response.status = http.StatusOK
+	}
+
+	header := response.Header()
+	if compress && header.Get("Content-Encoding") == "" && compressibleStatus(response.status) {
+		header.Set("Content-Encoding", response.encoding)
+		header.Del("Content-Length")
+
+		if response.encoding == "gzip" {
+			response.compressor = gzip.NewWriter(response.ResponseWriter)
+		}else{
+			response.compressor = zlib.NewWriter(response.ResponseWriter)
+		}
+	}
+
+	response.ResponseWriter.WriteHeader(response.status)
+
+	buffer := response.buffer
+	response.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+
+	_, writeError := response.Write(buffer)
+	return writeError
+}
+
+//finish sends the body that is still kept, which is smaller than the minimum size, and the end of the compressed body
+func (response *compressedResponse) finish(){
+	if !response.started {
+		response.start(false)
+	}
+	if response.compressor != nil {
+		response.compressor.Close()
+	}
+}
+
+//compressibleStatus tells if a response with the status has a body that can be compressed
+func compressibleStatus(status int) bool{
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+//acceptedEncoding chooses gzip or deflate from the Accept-Encoding header by their quality, gzip when both have the same one.
+//It gives an empty text when the client accepts neither of them
+func acceptedEncoding(acceptEncoding string) string{
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			if value := strings.TrimSpace(param); strings.HasPrefix(value, "q=") {
+				if parsed, qualityError := strconv.ParseFloat(strings.TrimPrefix(value, "q="), 64); qualityError == nil {
+					quality = parsed
+				}
+			}
+		}
+		qualities[coding] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range []string{"gzip", "deflate"} {
+		quality, accepted := qualities[encoding]
+		if !accepted {
+			quality, accepted = qualities["*"]
+		}
+		if accepted && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+
+	return best
+}
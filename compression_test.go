@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+
+	"net/http"
+	"net/http/httptest"
+)
+
+/* Compression Tests */
+
+func TestAcceptedEncoding(t *testing.T){
+	tests := []struct{
+		acceptEncoding string
+		encoding string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"GZIP", "gzip"},
+		{"gzip, deflate, br", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip; q=0.9 , deflate;q=0.8", "gzip"},
+		{"gzip;q=0", ""},
+		{"gzip;q=0, deflate;q=0.1", "deflate"},
+		{"*", "gzip"},
+		{"*;q=0.5, gzip;q=0", "deflate"},
+		{"br, identity", ""},
+	}
+
+	for _, test := range tests {
+		if encoding := acceptedEncoding(test.acceptEncoding); encoding != test.encoding {
+			t.Errorf("acceptedEncoding(%q) gave %q, %q expected", test.acceptEncoding, encoding, test.encoding)
+		}
+	}
+}
+
+func TestCompressResponses(t *testing.T){
+	long := strings.Repeat("Let It Be ", 20)
+
+	tests := []struct{
+		name string
+		method string
+		acceptEncoding string
+		status int
+		body []string
+		flush bool
+		encoding string
+	}{
+		{"long body with gzip", "GET", "gzip", http.StatusOK, []string{long}, false, "gzip"},
+		{"long body with deflate", "GET", "deflate", http.StatusOK, []string{long}, false, "deflate"},
+		{"long body written by parts", "GET", "gzip", http.StatusOK, []string{long[:50], long[50:]}, false, "gzip"},
+		{"short body", "GET", "gzip", http.StatusOK, []string{"short"}, false, ""},
+		{"short flushed body", "GET", "gzip", http.StatusOK, []string{"short"}, true, "gzip"},
+		{"long error", "GET", "gzip", http.StatusNotFound, []string{long}, false, "gzip"},
+		{"not modified", "GET", "gzip", http.StatusNotModified, nil, false, ""},
+		{"no content", "DELETE", "gzip", http.StatusNoContent, nil, false, ""},
+		{"head request", "HEAD", "gzip", http.StatusOK, nil, false, ""},
+		{"no accepted encoding", "GET", "br", http.StatusOK, []string{long}, false, ""},
+	}
+
+	for _, test := range tests {
+		handler := compressResponses(100)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(test.status)
+			for _, part := range test.body {
+				io.WriteString(w, part)
+			}
+			if test.flush {
+				w.(http.Flusher).Flush()
+			}
+		}))
+
+		r := httptest.NewRequest(test.method, "/songs", nil)
+		r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+
+		if recorder.Code != test.status {
+			t.Errorf("%s: the status is %d, %d expected", test.name, recorder.Code, test.status)
+		}
+		if encoding := recorder.Header().Get("Content-Encoding"); encoding != test.encoding {
+			t.Errorf("%s: the Content-Encoding is %q, %q expected", test.name, encoding, test.encoding)
+		}
+		if vary := recorder.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("%s: the Vary header is %q", test.name, vary)
+		}
+
+		body := decompressBody(t, recorder.Header().Get("Content-Encoding"), recorder.Body)
+		if expected := strings.Join(test.body, ""); body != expected {
+			t.Errorf("%s: the body is %q, %q expected", test.name, body, expected)
+		}
+	}
+}
+
+//decompressBody reads a body compressed with the given encoding, or as it is when the encoding is empty
+func decompressBody(t *testing.T, encoding string, body io.Reader) string{
+	var reader io.Reader = body
+	var readerError error
+	switch encoding {
+	case "gzip":
+		reader, readerError = gzip.NewReader(body)
+	case "deflate":
+		reader, readerError = zlib.NewReader(body)
+	}
+	if readerError != nil {
+		t.Fatalf("the %s body can not be read: %v", encoding, readerError)
+	}
+
+	content, readError := ioutil.ReadAll(reader)
+	if readError != nil {
+		t.Fatalf("the %s body can not be read: %v", encoding, readError)
+	}
+	return string(content)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"net/http"
+)
+
+/* Route Wrapper */
+
+//conditionalRoute answers the conditional reads of the catalog. The responses have an ETag made from the revision of the catalog,
+//the format and the version of the API, the Last-Modified time of the catalog and the Cache-Control header configured for the route.
+//A request whose If-None-Match has the ETag, or whose If-Modified-Since is not older than the last change, gets a 304 without a body.
+//If-None-Match: * only matches a resource that exists, so the handler runs and its success is answered with a 304
+func (s *server) conditionalRoute(cacheControl map[string]string, handler http.HandlerFunc) http.HandlerFunc{
+	return func(w http.ResponseWriter, r *http.Request){
+		format, formatError := negotiateFormat(r)
+		if formatError != nil {
+			handler(w, r)
+			return
+		}
+
+		//The revision is read before the catalog, so a change in between gives an older ETag and never hides the change
+		revision, modified, revisionError := catalogRevisionDB(r.Context(), s.database)
+		if revisionError != nil {
+			writeError(w, r, revisionError)
+			return
+		}
+
+		etag := fmt.Sprintf("W/\"%d-%s-v%d\"", revision, format.Name, apiVersion(r))
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", routeCacheControl(cacheControl, matchedPattern(r)))
+
+		if notModified(r, etag, modified) {
+			traceEvent(r.Context(), "not modified since the revision %d of the catalog", revision)
+			w.Header().Add("Vary", "Accept")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if matchesAnyETag(r) {
+			handler(&anyETagWriter{ResponseWriter: w}, r.WithContext(withCatalogRevision(r.Context(), revision)))
+			return
+		}
+
+		handler(w, r.WithContext(withCatalogRevision(r.Context(), revision)))
+	}
+}
+
+/* Types */
+
+//anyETagWriter answers with a 304 the successful responses to a request with If-None-Match: *, and lets the errors through
+type anyETagWriter struct{
+	http.ResponseWriter
+	wroteHeader bool
+	notModified bool
+}
+
+//WriteHeader sends a 304 instead of a successful status
+func (writer *anyETagWriter) WriteHeader(status int){
+	if writer.wroteHeader {
+		return
+	}
+	writer.wroteHeader = true
+
+	if status >= http.StatusOK && status < http.StatusMultipleChoices {
+		writer.notModified = true
+		writer.Header().Del("Trailer")
+		writer.Header().Add("Vary", "Accept")
+		writer.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writer.ResponseWriter.WriteHeader(status)
+}
+
+//Write drops the body of a 304
+func (writer *anyETagWriter) Write(data []byte) (int, error){
+	if !writer.wroteHeader {
+		writer.WriteHeader(http.StatusOK)
+	}
+	if writer.notModified {
+		return len(data), nil
+	}
+	return writer.ResponseWriter.Write(data)
+}
+
+//Flush sends the buffered response to the client when the wrapped writer can do it
+func (writer *anyETagWriter) Flush(){
+	if flusher, canFlush := writer.ResponseWriter.(http.Flusher); canFlush && !writer.notModified {
+		flusher.Flush()
+	}
+}
+
+/* Conditional Functions */
+
+//notModified tells if the representation that the client has is still the current one.
+//If-None-Match is checked with the weak comparison, and If-Modified-Since is only checked when there is no If-None-Match.
+//The * of If-None-Match is not checked here, since it depends on the resource existing
+func notModified(r *http.Request, etag string, modified time.Time) bool{
+	if ifNoneMatch, hasIfNoneMatch := r.Header["If-None-Match"]; hasIfNoneMatch {
+		for _, candidate := range ifNoneMatchETags(ifNoneMatch) {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, sinceError := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if sinceError != nil {
+		return false
+	}
+
+	//The HTTP dates have whole seconds
+	return !modified.Truncate(time.Second).After(since)
+}
+
+//matchesAnyETag tells if the If-None-Match header of the request has *
+func matchesAnyETag(r *http.Request) bool{
+	for _, candidate := range ifNoneMatchETags(r.Header["If-None-Match"]) {
+		if candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+//ifNoneMatchETags gives the ETags of the If-None-Match headers, which can have several ones separated by commas
+func ifNoneMatchETags(ifNoneMatch []string) []string{
+	var etags []string
+	for _, candidate := range strings.Split(strings.Join(ifNoneMatch, ","), ",") {
+		if candidate = strings.TrimSpace(candidate); candidate != "" {
+			etags = append(etags, candidate)
+		}
+	}
+	return etags
+}
+
+//routeCacheControl gives the Cache-Control header configured for the route pattern in any version of the API,
+//or the one of "*" when the route is not configured
+func routeCacheControl(cacheControl map[string]string, routePattern string) string{
+	if directives, hasDirectives := cacheControl[unversionedPattern(routePattern)]; hasDirectives {
+		return directives
+	}
+	if directives, hasDirectives := cacheControl["*"]; hasDirectives {
+		return directives
+	}
+	return "no-cache"
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"net/http"
+	"net/http/httptest"
+)
+
+/* Conditional Tests */
+
+func TestNotModified(t *testing.T){
+	etag := "W/\"7-json-v1\""
+	modified := time.Date(2017, 3, 1, 10, 0, 0, 500, time.UTC)
+
+	tests := []struct{
+		name string
+		headers map[string]string
+		notModified bool
+	}{
+		{"no conditions", nil, false},
+		{"same ETag", map[string]string{"If-None-Match": "W/\"7-json-v1\""}, true},
+		{"same ETag with the strong form", map[string]string{"If-None-Match": "\"7-json-v1\""}, true},
+		{"ETag in a list", map[string]string{"If-None-Match": "\"6-json-v1\", W/\"7-json-v1\""}, true},
+		{"other ETag", map[string]string{"If-None-Match": "W/\"6-json-v1\""}, false},
+		{"other format", map[string]string{"If-None-Match": "W/\"7-csv-v1\""}, false},
+		{"any ETag is left to the handler", map[string]string{"If-None-Match": "*"}, false},
+		{"modified at the same second", map[string]string{"If-Modified-Since": "Wed, 01 Mar 2017 10:00:00 GMT"}, true},
+		{"modified before", map[string]string{"If-Modified-Since": "Wed, 01 Mar 2017 10:00:05 GMT"}, true},
+		{"modified after", map[string]string{"If-Modified-Since": "Wed, 01 Mar 2017 09:59:59 GMT"}, false},
+		{"invalid date", map[string]string{"If-Modified-Since": "yesterday"}, false},
+		{"If-Modified-Since ignored with If-None-Match", map[string]string{
+			"If-None-Match": "W/\"6-json-v1\"", "If-Modified-Since": "Wed, 01 Mar 2017 10:00:05 GMT"}, false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/songs", nil)
+		for name, value := range test.headers {
+			r.Header.Set(name, value)
+		}
+
+		if result := notModified(r, etag, modified); result != test.notModified {
+			t.Errorf("%s: notModified is %v, %v expected", test.name, result, test.notModified)
+		}
+	}
+}
+
+func TestConditionalRoute(t *testing.T){
+	handlers := newServer(newTestDatabase(t))
+	cacheControl := map[string]string{"*": "max-age=60"}
+
+	found := handlers.conditionalRoute(cacheControl, func(w http.ResponseWriter, r *http.Request){
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("{\"ID\":1}"))
+	})
+	missing := handlers.conditionalRoute(cacheControl, func(w http.ResponseWriter, r *http.Request){
+		writeError(w, r, newNotFoundError("Song not found: 1"))
+	})
+
+	//The first request gives the current validators
+	w := httptest.NewRecorder()
+	found(w, httptest.NewRequest("GET", "/songs/1", nil))
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if etag == "" || lastModified == "" || w.Header().Get("Cache-Control") != "max-age=60" {
+		t.Fatalf("the response has the ETag %q, the Last-Modified %q and the Cache-Control %q",
+			etag, lastModified, w.Header().Get("Cache-Control"))
+	}
+
+	tests := []struct{
+		name string
+		handler http.HandlerFunc
+		path string
+		headers map[string]string
+		status int
+		body bool
+		validators bool
+	}{
+		{"matching If-None-Match", found, "/songs/1", map[string]string{"If-None-Match": etag}, http.StatusNotModified, false, true},
+		{"other If-None-Match", found, "/songs/1", map[string]string{"If-None-Match": "W/\"0-json-v1\""}, http.StatusOK, true, true},
+		{"ETag of another format", found, "/songs/1?format=csv", map[string]string{"If-None-Match": etag}, http.StatusOK, true, true},
+		{"ETag of another version", found, "/v2/songs/1", map[string]string{"If-None-Match": etag}, http.StatusOK, true, true},
+		{"If-Modified-Since the last change", found, "/songs/1", map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified, false, true},
+		{"If-Modified-Since before the last change", found, "/songs/1", map[string]string{"If-Modified-Since": "Sat, 01 Jan 2000 00:00:00 GMT"}, http.StatusOK, true, true},
+		{"any ETag of a song that exists", found, "/songs/1", map[string]string{"If-None-Match": "*"}, http.StatusNotModified, false, true},
+		{"any ETag of a song that does not exist", missing, "/songs/1", map[string]string{"If-None-Match": "*"}, http.StatusNotFound, true, false},
+		{"error", missing, "/songs/1", nil, http.StatusNotFound, true, false},
+		{"error with a matching If-None-Match", missing, "/songs/1", map[string]string{"If-None-Match": "W/\"0-json-v1\""}, http.StatusNotFound, true, false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		for name, value := range test.headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		test.handler(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s: the status is %d, %d expected", test.name, w.Code, test.status)
+		}
+		if (w.Body.Len() > 0) != test.body {
+			t.Errorf("%s: the body is %q", test.name, w.Body.String())
+		}
+
+		//The errors have no validators and are never stored
+		hasValidators := w.Header().Get("ETag") != "" && w.Header().Get("Last-Modified") != ""
+		if hasValidators != test.validators {
+			t.Errorf("%s: the ETag is %q and the Last-Modified %q", test.name, w.Header().Get("ETag"), w.Header().Get("Last-Modified"))
+		}
+		if !test.validators && w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: the Cache-Control of the error is %q, no-store expected", test.name, w.Header().Get("Cache-Control"))
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"flag"
+	"strconv"
+	"strings"
+	"time"
+	"encoding/json"
+	"io/ioutil"
+)
+
+/* Types */
+
+//config holds the settings of the server
+type config struct{
+	ListenAddress string
+	DatabasePath string
+
+	ReadTimeout time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout time.Duration
+	ShutdownTimeout time.Duration
+	DatabaseBusyTimeout time.Duration
+	DatabaseMaxOpenConns int
+
+	LogLevel string
+	AccessLog bool
+	AccessLogSampleRate float64
+	AccessLogRedact []string
+
+	//Feature toggles
+	EnableSearch bool
+	EnableWrites bool
+	EnableMetrics bool
+	EnableTracing bool
+	RequireAPIKey bool
+	RateLimit bool
+	RateLimitSearch rateLimitRule
+	RateLimitList rateLimitRule
+	DailyQuota int
+	QueryCacheSize int
+	Compression bool
+	CompressionMinSize int
+	AutoMigrate bool
+
+	//Date when the version 1 of the API stops being served
+	V1Sunset time.Time
+
+	//Cache-Control header of the catalog reads by route pattern, the routes that are not listed use the one of "*"
+	CacheControl map[string]string
+
+	//Cross-origin requests of the browsers, which are not allowed when there are no allowed origins
+	CORSAllowedOrigins []string
+	CORSAllowedMethods []string
+	CORSAllowedHeaders []string
+	CORSExposedHeaders []string
+	CORSAllowCredentials bool
+	CORSMaxAge time.Duration
+}
+
+//setting is a value of the config that can be given as a flag, as a BV_* environment variable or in the config file.
+//The settings whose default is true or false are bools, their flags can be given without a value like -require-api-key
+type setting struct{
+	Name string
+	Usage string
+	Default string
+	Apply func(settings *config, value string) error
+}
+
+//flagValue is the value of a setting given as a flag, kept as a text until the setting is applied
+type flagValue struct{
+	value string
+	boolean bool
+}
+
+/* Settings */
+
+//Levels accepted by the log-level setting, from the most to the least verbose
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+//configSettings lists every setting of the config. The name is used as the flag and as the key in the config file,
+//and the environment variable is the name in upper case with the BV_ prefix, for example BV_READ_TIMEOUT
+var configSettings = []setting{
+	{"listen", "host and port where the server listens", "localhost:8080", func(settings *config, value string) error{
+		if _, _, addressError := net.SplitHostPort(value); addressError != nil {
+			return addressError
+		}
+		settings.ListenAddress = value
+		return nil
+	}},
+	{"db", "file path of the SQLite database", "./jrdd.db", func(settings *config, value string) error{
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("the file path can not be empty")
+		}
+		settings.DatabasePath = value
+		return nil
+	}},
+	{"read-timeout", "longest time to read a request", "10s", durationSetting(func(settings *config) *time.Duration { return &settings.ReadTimeout })},
+	{"write-timeout", "longest time to write a response", "30s", durationSetting(func(settings *config) *time.Duration { return &settings.WriteTimeout })},
+	{"idle-timeout", "longest time to keep an idle connection open", "60s", durationSetting(func(settings *config) *time.Duration { return &settings.IdleTimeout })},
+	{"shutdown-timeout", "longest time to finish the requests in flight when the server stops", "15s", durationSetting(func(settings *config) *time.Duration { return &settings.ShutdownTimeout })},
+	{"db-busy-timeout", "longest time to wait for a locked database", "5s", durationSetting(func(settings *config) *time.Duration { return &settings.DatabaseBusyTimeout })},
+	{"db-max-open-conns", "size of the database connection pool", "8", func(settings *config, value string) error{
+		number, numberError := strconv.Atoi(value)
+		if numberError != nil || number < 1 {
+			return fmt.Errorf("it has to be a number greater than 0")
+		}
+		settings.DatabaseMaxOpenConns = number
+		return nil
+	}},
+	{"log-level", "least important level logged: " + strings.Join(logLevels, ", "), "info", func(settings *config, value string) error{
+		for _, level := range logLevels {
+			if strings.ToLower(value) == level {
+				settings.LogLevel = level
+				return nil
+			}
+		}
+		return fmt.Errorf("it has to be one of %s", strings.Join(logLevels, ", "))
+	}},
+	{"access-log", "log a JSON line for each request", "true", boolSetting(func(settings *config) *bool { return &settings.AccessLog })},
+	{"access-log-sample-rate", "fraction of the successful requests that are logged, from 0 to 1", "1", func(settings *config, value string) error{
+		rate, rateError := strconv.ParseFloat(value, 64)
+		if rateError != nil || rate < 0 || rate > 1 {
+			return fmt.Errorf("it has to be a number from 0 to 1")
+		}
+		settings.AccessLogSampleRate = rate
+		return nil
+	}},
+	{"access-log-redact", "comma separated names of the path and query parameters whose values are not logged", "", listSetting(func(settings *config) *[]string { return &settings.AccessLogRedact })},
+	{"enable-search", "serve the full-text search route", "true", boolSetting(func(settings *config) *bool { return &settings.EnableSearch })},
+	{"enable-writes", "serve the routes that change songs and genres", "true", boolSetting(func(settings *config) *bool { return &settings.EnableWrites })},
+	{"enable-metrics", "serve the Prometheus metrics route and record the metrics", "true", boolSetting(func(settings *config) *bool { return &settings.EnableMetrics })},
+	{"enable-tracing", "trace the requests and serve the /debug/requests and /debug/events pages", "true", boolSetting(func(settings *config) *bool { return &settings.EnableTracing })},
+	{"require-api-key", "answer only the requests with a valid API key whose role allows the route", "false", boolSetting(func(settings *config) *bool { return &settings.RequireAPIKey })},
+	{"rate-limit", "limit the requests of each API key or IP address", "false", boolSetting(func(settings *config) *bool { return &settings.RateLimit })},
+	{"rate-limit-search", "requests per duration allowed to each client in the routes that filter or search songs", "60/1m", rateLimitSetting(func(settings *config) *rateLimitRule { return &settings.RateLimitSearch })},
+	{"rate-limit-list", "requests per duration allowed to each client in the other routes", "300/1m", rateLimitSetting(func(settings *config) *rateLimitRule { return &settings.RateLimitList })},
+	{"daily-quota", "requests allowed to each client per UTC day when the rate limit is on, 0 for no quota", "0", func(settings *config, value string) error{
+		number, numberError := strconv.Atoi(value)
+		if numberError != nil || number < 0 {
+			return fmt.Errorf("it has to be a number greater than or equal to 0")
+		}
+		settings.DailyQuota = number
+		return nil
+	}},
+	{"query-cache-size", "number of catalog query results kept in memory until the catalog changes, 0 to turn the cache off", "256", func(settings *config, value string) error{
+		number, numberError := strconv.Atoi(value)
+		if numberError != nil || number < 0 {
+			return fmt.Errorf("it has to be a number greater than or equal to 0")
+		}
+		settings.QueryCacheSize = number
+		return nil
+	}},
+	{"compression", "compress the responses with gzip or deflate when the client accepts it", "true", boolSetting(func(settings *config) *bool { return &settings.Compression })},
+	{"compression-min-size", "smallest body in bytes that is compressed", "1024", func(settings *config, value string) error{
+		number, numberError := strconv.Atoi(value)
+		if numberError != nil || number < 0 {
+			return fmt.Errorf("it has to be a number greater than or equal to 0")
+		}
+		settings.CompressionMinSize = number
+		return nil
+	}},
+	{"v1-sunset", "date when the version 1 of the API stops being served, given to the clients in the Sunset header", "2027-06-30", func(settings *config, value string) error{
+		sunset, dateError := time.Parse("2006-01-02", value)
+		if dateError != nil {
+			return fmt.Errorf("it has to be a date like 2027-06-30")
+		}
+		settings.V1Sunset = sunset
+		return nil
+	}},
+	{"cache-control", "Cache-Control header of the catalog reads, like no-cache, and of some routes with entries like /genres=max-age=300 separated by ;", "no-cache", func(settings *config, value string) error{
+		settings.CacheControl = map[string]string{"*": "no-cache"}
+		for _, entry := range strings.Split(value, ";") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			if !strings.HasPrefix(entry, "/") {
+				settings.CacheControl["*"] = entry
+				continue
+			}
+
+			parts := strings.SplitN(entry, "=", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+				return fmt.Errorf("the entry %q has to be a route pattern and its directives like /genres=max-age=300", entry)
+			}
+			settings.CacheControl[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+		return nil
+	}},
+	{"cors-allowed-origins", "comma separated origins whose browsers can call the API, like https://app.example.com, or * for any origin", "", listSetting(func(settings *config) *[]string { return &settings.CORSAllowedOrigins })},
+	{"cors-allowed-methods", "comma separated methods that the browsers can use in cross-origin requests", "GET, HEAD, POST, PUT, PATCH, DELETE", listSetting(func(settings *config) *[]string { return &settings.CORSAllowedMethods })},
+	{"cors-allowed-headers", "comma separated headers that the browsers can send in cross-origin requests", "Accept, Authorization, Content-Type, If-Modified-Since, If-None-Match, X-API-Key, X-Request-ID, traceparent", listSetting(func(settings *config) *[]string { return &settings.CORSAllowedHeaders })},
+	{"cors-exposed-headers", "comma separated headers of the responses that the browsers can read in cross-origin requests", "ETag, Last-Modified, Link, Location, Retry-After, X-Total-Count, X-Request-ID, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-Quota-Limit, X-Quota-Remaining, Deprecation, Sunset", listSetting(func(settings *config) *[]string { return &settings.CORSExposedHeaders })},
+	{"cors-allow-credentials", "let the browsers send cookies and authorization headers in cross-origin requests", "false", boolSetting(func(settings *config) *bool { return &settings.CORSAllowCredentials })},
+	{"cors-max-age", "longest time that the browsers keep the answer of a preflight request", "10m", durationSetting(func(settings *config) *time.Duration { return &settings.CORSMaxAge })},
+	{"auto-migrate", "apply the pending migrations when the server starts", "true", boolSetting(func(settings *config) *bool { return &settings.AutoMigrate })},
+}
+
+/* Config Functions */
+
+//loadConfig reads the config from the defaults, the config file, the BV_* environment variables and the flags given in args,
+//each one overriding the previous ones. It also gives the arguments left after the flags
+func loadConfig(args []string) (config, []string, error){
+	settings := config{}
+
+	//Flags are parsed first to know the config file, but they are applied last
+	flags := flag.NewFlagSet("BeenVerified", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("BV_CONFIG"), "optional JSON config file (env BV_CONFIG)")
+	flagValues := map[string]*flagValue{}
+	for _, current := range configSettings {
+		flagValues[current.Name] = &flagValue{value: current.Default, boolean: current.isBool()}
+		flags.Var(flagValues[current.Name], current.Name, current.Usage + " (env " + settingEnvName(current.Name) + ")")
+	}
+	if parseError := flags.Parse(args); parseError != nil {
+		return settings, nil, parseError
+	}
+
+	givenFlags := map[string]bool{}
+	flags.Visit(func(given *flag.Flag){
+		givenFlags[given.Name] = true
+	})
+
+	fileValues := map[string]string{}
+	if *configFile != "" {
+		var fileError error
+		fileValues, fileError = readConfigFile(*configFile)
+		if fileError != nil {
+			return settings, nil, fileError
+		}
+	}
+
+	for _, current := range configSettings {
+		value, source := current.Default, "default"
+
+		if fileValue, inFile := fileValues[current.Name]; inFile {
+			value, source = fileValue, "config file " + *configFile
+		}
+		if envValue, inEnv := os.LookupEnv(settingEnvName(current.Name)); inEnv {
+			value, source = envValue, "environment variable " + settingEnvName(current.Name)
+		}
+		if givenFlags[current.Name] {
+			value, source = flagValues[current.Name].value, "flag -" + current.Name
+		}
+
+		if applyError := current.Apply(&settings, strings.TrimSpace(value)); applyError != nil {
+			return settings, nil, fmt.Errorf("invalid %s %q from %s: %v", current.Name, value, source, applyError)
+		}
+	}
+
+	//Any origin with credentials would let every site read the API with the cookies and authorization of its visitors
+	for _, origin := range settings.CORSAllowedOrigins {
+		if origin == "*" && settings.CORSAllowCredentials {
+			return settings, nil, fmt.Errorf("cors-allow-credentials can not be true when cors-allowed-origins has *, list the allowed origins instead")
+		}
+	}
+
+	return settings, flags.Args(), nil
+}
+
+//readConfigFile reads the settings of a JSON config file, whose keys are the names of the settings
+func readConfigFile(filePath string) (map[string]string, error){
+	content, readError := ioutil.ReadFile(filePath)
+	if readError != nil {
+		return nil, readError
+	}
+
+	fileValues := map[string]interface{}{}
+	if jsonError := json.Unmarshal(content, &fileValues); jsonError != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", filePath, jsonError)
+	}
+
+	values := map[string]string{}
+	for name, value := range fileValues {
+		if !isSetting(name) {
+			return nil, fmt.Errorf("unknown setting %q in config file %s", name, filePath)
+		}
+
+		text, valueError := configFileValue(value, true)
+		if valueError != nil {
+			return nil, fmt.Errorf("invalid %s in config file %s: %v", name, filePath, valueError)
+		}
+		values[name] = text
+	}
+
+	return values, nil
+}
+
+//configFileValue gives the text of a value of the config file as it would be given in a flag.
+//The numbers are written without exponent, and a list, when allowed, is joined with commas
+func configFileValue(value interface{}, allowList bool) (string, error){
+	switch typed := value.(type) {
+	case string:
+		return typed, nil
+	case bool:
+		return strconv.FormatBool(typed), nil
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64), nil
+	case []interface{}:
+		if !allowList {
+			return "", fmt.Errorf("the items of a list have to be texts, numbers or booleans")
+		}
+		items := make([]string, len(typed))
+		for index, item := range typed {
+			text, itemError := configFileValue(item, false)
+			if itemError != nil {
+				return "", itemError
+			}
+			items[index] = text
+		}
+		return strings.Join(items, ","), nil
+	case nil:
+		return "", fmt.Errorf("it can not be null")
+	default:
+		return "", fmt.Errorf("it has to be a text, a number, a boolean or a list")
+	}
+}
+
+//isSetting tells if there is a setting with the given name
+func isSetting(name string) bool{
+	for _, current := range configSettings {
+		if current.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+//isBool tells if the setting is true or false
+func (current setting) isBool() bool{
+	return current.Default == "true" || current.Default == "false"
+}
+
+//String gives the text of the flag
+func (given *flagValue) String() string{
+	if given == nil {
+		return ""
+	}
+	return given.value
+}
+
+//Set keeps the text of the flag, which is true when a bool flag is given without a value
+func (given *flagValue) Set(value string) error{
+	given.value = value
+	return nil
+}
+
+//IsBoolFlag tells the flag package that the flag can be given without a value
+func (given *flagValue) IsBoolFlag() bool{
+	return given.boolean
+}
+
+//settingEnvName gives the environment variable of the setting with the given name
+func settingEnvName(name string) string{
+	return "BV_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+//durationSetting applies a setting that is a positive duration like 500ms, 10s or 1m
+func durationSetting(field func(settings *config) *time.Duration) func(settings *config, value string) error{
+	return func(settings *config, value string) error{
+		duration, durationError := time.ParseDuration(value)
+		if durationError != nil || duration <= 0 {
+			return fmt.Errorf("it has to be a positive duration like 500ms, 10s or 1m")
+		}
+		*field(settings) = duration
+		return nil
+	}
+}
+
+//boolSetting applies a setting that is true or false
+func boolSetting(field func(settings *config) *bool) func(settings *config, value string) error{
+	return func(settings *config, value string) error{
+		enabled, boolError := strconv.ParseBool(value)
+		if boolError != nil {
+			return fmt.Errorf("it has to be true or false")
+		}
+		*field(settings) = enabled
+		return nil
+	}
+}
+
+//listSetting applies a setting that is a comma separated list, the empty items are left out
+func listSetting(field func(settings *config) *[]string) func(settings *config, value string) error{
+	return func(settings *config, value string) error{
+		*field(settings) = []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field(settings) = append(*field(settings), item)
+			}
+		}
+		return nil
+	}
+}
+
+//rateLimitSetting applies a setting that is a number of requests per duration like 60/1m
+func rateLimitSetting(field func(settings *config) *rateLimitRule) func(settings *config, value string) error{
+	return func(settings *config, value string) error{
+		rule, ruleError := parseRateLimitRule(value)
+		if ruleError != nil {
+			return ruleError
+		}
+		*field(settings) = rule
+		return nil
+	}
+}
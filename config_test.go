@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"io/ioutil"
+	"path/filepath"
+)
+
+/* Config Tests */
+
+func TestLoadConfigPrecedence(t *testing.T){
+	tests := []struct{
+		name string
+		file string
+		env map[string]string
+		args []string
+
+		listen string
+		readTimeout time.Duration
+		enableWrites bool
+		dailyQuota int
+		origins []string
+		rest []string
+	}{
+		{
+			name: "defaults",
+			listen: "localhost:8080", readTimeout: 10 * time.Second, enableWrites: true,
+		},
+		{
+			name: "config file over the defaults",
+			file: `{"listen": "localhost:9000", "read-timeout": "20s", "enable-writes": false}`,
+			listen: "localhost:9000", readTimeout: 20 * time.Second,
+		},
+		{
+			name: "environment over the config file",
+			file: `{"listen": "localhost:9000", "read-timeout": "20s", "enable-writes": false}`,
+			env: map[string]string{"BV_LISTEN": "localhost:9100", "BV_ENABLE_WRITES": "true"},
+			listen: "localhost:9100", readTimeout: 20 * time.Second, enableWrites: true,
+		},
+		{
+			name: "flags over the environment",
+			file: `{"listen": "localhost:9000"}`,
+			env: map[string]string{"BV_LISTEN": "localhost:9100", "BV_READ_TIMEOUT": "30s"},
+			args: []string{"-listen", "localhost:9200", "-enable-writes=false"},
+			listen: "localhost:9200", readTimeout: 30 * time.Second,
+		},
+		{
+			name: "config file list and large number",
+			file: `{"cors-allowed-origins": ["https://a.example.com", "https://b.example.com"], "daily-quota": 1000000}`,
+			listen: "localhost:8080", readTimeout: 10 * time.Second, enableWrites: true,
+			dailyQuota: 1000000, origins: []string{"https://a.example.com", "https://b.example.com"},
+		},
+		{
+			name: "arguments after the flags",
+			args: []string{"-listen", "localhost:9200", "migrate", "status"},
+			listen: "localhost:9200", readTimeout: 10 * time.Second, enableWrites: true, rest: []string{"migrate", "status"},
+		},
+		{
+			name: "bool flag without a value",
+			env: map[string]string{"BV_ENABLE_WRITES": "false"},
+			args: []string{"-enable-writes", "migrate", "status"},
+			listen: "localhost:8080", readTimeout: 10 * time.Second, enableWrites: true, rest: []string{"migrate", "status"},
+		},
+		{
+			name: "bool flag set to false",
+			file: `{"enable-writes": true}`,
+			args: []string{"-enable-writes=false"},
+			listen: "localhost:8080", readTimeout: 10 * time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T){
+			args := test.args
+			if test.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, test.file)}, args...)
+			}
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			settings, rest, configError := loadConfig(args)
+			if configError != nil {
+				t.Fatalf("the config can not be loaded: %v", configError)
+			}
+
+			if settings.ListenAddress != test.listen {
+				t.Errorf("listen is %s, %s expected", settings.ListenAddress, test.listen)
+			}
+			if settings.ReadTimeout != test.readTimeout {
+				t.Errorf("read-timeout is %v, %v expected", settings.ReadTimeout, test.readTimeout)
+			}
+			if settings.EnableWrites != test.enableWrites {
+				t.Errorf("enable-writes is %v, %v expected", settings.EnableWrites, test.enableWrites)
+			}
+			if settings.DailyQuota != test.dailyQuota {
+				t.Errorf("daily-quota is %d, %d expected", settings.DailyQuota, test.dailyQuota)
+			}
+			if strings.Join(settings.CORSAllowedOrigins, " ") != strings.Join(test.origins, " ") {
+				t.Errorf("cors-allowed-origins is %v, %v expected", settings.CORSAllowedOrigins, test.origins)
+			}
+			if strings.Join(rest, " ") != strings.Join(test.rest, " ") {
+				t.Errorf("the arguments left are %v, %v expected", rest, test.rest)
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T){
+	tests := []struct{
+		name string
+		file string
+		env map[string]string
+		args []string
+		message string
+	}{
+		{name: "invalid flag", args: []string{"-read-timeout", "soon"}, message: "flag -read-timeout"},
+		{name: "invalid environment variable", env: map[string]string{"BV_DB_MAX_OPEN_CONNS": "0"}, message: "environment variable BV_DB_MAX_OPEN_CONNS"},
+		{name: "invalid config file value", file: `{"log-level": "loud"}`, message: "config file"},
+		{name: "unknown config file key", file: `{"colour": "blue"}`, message: "unknown setting"},
+		{name: "config file object", file: `{"cache-control": {"/genres": "max-age=300"}}`, message: "invalid cache-control"},
+		{name: "config file null", file: `{"listen": null}`, message: "invalid listen"},
+		{name: "config file nested list", file: `{"cors-allowed-origins": [["https://a.example.com"]]}`, message: "invalid cors-allowed-origins"},
+		{name: "credentials with any origin", args: []string{"-cors-allowed-origins", "*", "-cors-allow-credentials"}, message: "cors-allow-credentials"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T){
+			args := test.args
+			if test.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, test.file)}, args...)
+			}
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			_, _, configError := loadConfig(args)
+			if configError == nil || !strings.Contains(configError.Error(), test.message) {
+				t.Errorf("the error is %v, one about %s expected", configError, test.message)
+			}
+		})
+	}
+}
+
+//writeConfigFile writes a config file in a temporary folder of the test and gives its path
+func writeConfigFile(t *testing.T, content string) string{
+	filePath := filepath.Join(t.TempDir(), "config.json")
+	if writeError := ioutil.WriteFile(filePath, []byte(content), 0644); writeError != nil {
+		t.Fatal(writeError)
+	}
+	return filePath
+}
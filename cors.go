@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"net/http"
+)
+
+/* Types */
+
+//corsPolicy tells the browsers which cross-origin requests to the API are allowed
+type corsPolicy struct{
+	AllowedOrigins map[string]bool
+	AnyOrigin bool
+	AllowedMethods string
+	AllowedHeaders string
+	ExposedHeaders string
+	AllowCredentials bool
+	MaxAge time.Duration
+}
+
+/* CORS Functions */
+
+//newCORSPolicy creates a policy that allows the given origins, or any origin when one of them is *
+func newCORSPolicy(origins []string, methods []string, headers []string, exposedHeaders []string, allowCredentials bool, maxAge time.Duration) *corsPolicy{
+	policy := &corsPolicy{
+		AllowedOrigins: map[string]bool{},
+		AllowedMethods: strings.Join(methods, ", "),
+		AllowedHeaders: strings.Join(headers, ", "),
+		ExposedHeaders: strings.Join(exposedHeaders, ", "),
+		AllowCredentials: allowCredentials,
+		MaxAge: maxAge,
+	}
+
+	for _, origin := range origins {
+		if origin == "*" {
+			policy.AnyOrigin = true
+		}
+		policy.AllowedOrigins[normalizeOrigin(origin)] = true
+	}
+
+	return policy
+}
+
+//middleware adds the CORS headers to the responses of the allowed origins and answers their preflight requests.
+//The preflight requests are answered before the API key and the rate limit are checked, since the browsers send them without credentials.
+//A preflight request from an origin that is not allowed gets a 403 error
+func (policy *corsPolicy) middleware(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !policy.allows(origin) {
+			if preflight {
+				writeError(w, r, newForbiddenError("Cross-origin requests from " + origin + " are not allowed"))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		//Any origin is answered with * and never with the credentials, which are only allowed for the listed origins
+		if policy.AnyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}else{
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			if policy.ExposedHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", policy.ExposedHeaders)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		traceEvent(r.Context(), "preflight from %s for %s", origin, r.Header.Get("Access-Control-Request-Method"))
+		w.Header().Set("Access-Control-Allow-Methods", policy.AllowedMethods)
+		w.Header().Set("Access-Control-Allow-Headers", policy.AllowedHeaders)
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge / time.Second)))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+//allows tells if the requests from the origin are allowed
+func (policy *corsPolicy) allows(origin string) bool{
+	return policy.AnyOrigin || policy.AllowedOrigins[normalizeOrigin(origin)]
+}
+
+//normalizeOrigin gives an origin in lower case and without a trailing slash, so the configured origins match the ones sent by the browsers
+func normalizeOrigin(origin string) string{
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
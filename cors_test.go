@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"net/http"
+	"net/http/httptest"
+)
+
+/* CORS Tests */
+
+func TestCORSMiddleware(t *testing.T){
+	methods := []string{"GET", "POST"}
+	headers := []string{"Authorization", "Content-Type"}
+	exposed := []string{"Link", "X-Total-Count"}
+
+	listed := newCORSPolicy([]string{"https://app.example.com/"}, methods, headers, exposed, false, 10 * time.Minute)
+	listedWithCredentials := newCORSPolicy([]string{"https://app.example.com"}, methods, headers, exposed, true, 10 * time.Minute)
+	anyOrigin := newCORSPolicy([]string{"*"}, methods, headers, exposed, false, 10 * time.Minute)
+	anyOriginWithCredentials := newCORSPolicy([]string{"*"}, methods, headers, exposed, true, 10 * time.Minute)
+
+	tests := []struct{
+		name string
+		policy *corsPolicy
+		method string
+		origin string
+		requestMethod string
+
+		status int
+		allowOrigin string
+		allowCredentials string
+		exposeHeaders string
+		allowMethods string
+		maxAge string
+		vary string
+	}{
+		{
+			name: "same origin", policy: listed, method: "GET",
+			status: http.StatusOK, vary: "Origin",
+		},
+		{
+			name: "allowed origin", policy: listed, method: "GET", origin: "https://APP.example.com",
+			status: http.StatusOK, allowOrigin: "https://APP.example.com", exposeHeaders: "Link, X-Total-Count", vary: "Origin",
+		},
+		{
+			name: "allowed origin with credentials", policy: listedWithCredentials, method: "GET", origin: "https://app.example.com",
+			status: http.StatusOK, allowOrigin: "https://app.example.com", allowCredentials: "true", exposeHeaders: "Link, X-Total-Count", vary: "Origin",
+		},
+		{
+			name: "disallowed origin", policy: listed, method: "GET", origin: "https://evil.example.com",
+			status: http.StatusOK, vary: "Origin",
+		},
+		{
+			name: "any origin", policy: anyOrigin, method: "GET", origin: "https://other.example.com",
+			status: http.StatusOK, allowOrigin: "*", exposeHeaders: "Link, X-Total-Count", vary: "Origin",
+		},
+		{
+			name: "any origin never sends the credentials", policy: anyOriginWithCredentials, method: "GET", origin: "https://other.example.com",
+			status: http.StatusOK, allowOrigin: "*", exposeHeaders: "Link, X-Total-Count", vary: "Origin",
+		},
+		{
+			name: "preflight from an allowed origin", policy: listedWithCredentials, method: "OPTIONS", origin: "https://app.example.com", requestMethod: "POST",
+			status: http.StatusNoContent, allowOrigin: "https://app.example.com", allowCredentials: "true", allowMethods: "GET, POST", maxAge: "600",
+			vary: "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+		},
+		{
+			name: "preflight from any origin", policy: anyOriginWithCredentials, method: "OPTIONS", origin: "https://other.example.com", requestMethod: "POST",
+			status: http.StatusNoContent, allowOrigin: "*", allowMethods: "GET, POST", maxAge: "600",
+			vary: "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+		},
+		{
+			name: "preflight from a disallowed origin", policy: listed, method: "OPTIONS", origin: "https://evil.example.com", requestMethod: "POST",
+			status: http.StatusForbidden, vary: "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+		},
+		{
+			name: "options without a requested method", policy: listed, method: "OPTIONS", origin: "https://app.example.com",
+			status: http.StatusOK, allowOrigin: "https://app.example.com", exposeHeaders: "Link, X-Total-Count", vary: "Origin",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T){
+			handler := test.policy.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			r := httptest.NewRequest(test.method, "/songs", nil)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			if test.requestMethod != "" {
+				r.Header.Set("Access-Control-Request-Method", test.requestMethod)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("the status is %d, %d expected", w.Code, test.status)
+			}
+
+			expectedHeaders := map[string]string{
+				"Access-Control-Allow-Origin": test.allowOrigin,
+				"Access-Control-Allow-Credentials": test.allowCredentials,
+				"Access-Control-Expose-Headers": test.exposeHeaders,
+				"Access-Control-Allow-Methods": test.allowMethods,
+				"Access-Control-Max-Age": test.maxAge,
+			}
+			for name, expected := range expectedHeaders {
+				if value := w.Header().Get(name); value != expected {
+					t.Errorf("%s is %q, %q expected", name, value, expected)
+				}
+			}
+			if vary := strings.Join(w.Header()["Vary"], ", "); vary != test.vary {
+				t.Errorf("Vary is %q, %q expected", vary, test.vary)
+			}
+		})
+	}
+}
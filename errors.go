@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+
+	"net/http"
+)
+
+//apiError is an error that is shown to the client with its HTTP status
+type apiError struct{
+	Status int
+	Code string
+	Message string
+}
+
+//Error gives the message of the error
+func (e *apiError) Error() string{
+	return e.Message
+}
+
+//newBadRequestError creates an error for a request that can not be processed as it was sent
+func newBadRequestError(message string) error{
+	return &apiError{Status: http.StatusBadRequest, Code: "bad_request", Message: message}
+}
+
+//newUnauthorizedError creates an error for a request without a valid API key
+func newUnauthorizedError(message string) error{
+	return &apiError{Status: http.StatusUnauthorized, Code: "unauthorized", Message: message}
+}
+
+//newForbiddenError creates an error for a request whose API key does not have the role needed by the route
+func newForbiddenError(message string) error{
+	return &apiError{Status: http.StatusForbidden, Code: "forbidden", Message: message}
+}
+
+//newNotFoundError creates an error for a resource that does not exist
+func newNotFoundError(message string) error{
+	return &apiError{Status: http.StatusNotFound, Code: "not_found", Message: message}
+}
+
+//newNotAcceptableError creates an error for a request that accepts none of the formats of the results
+func newNotAcceptableError(message string) error{
+	return &apiError{Status: http.StatusNotAcceptable, Code: "not_acceptable", Message: message}
+}
+
+//newConflictError creates an error for a request that conflicts with the data stored in the database
+func newConflictError(message string) error{
+	return &apiError{Status: http.StatusConflict, Code: "conflict", Message: message}
+}
+
+//newTooManyRequestsError creates an error for a client that went over its rate limit or its daily quota
+func newTooManyRequestsError(message string) error{
+	return &apiError{Status: http.StatusTooManyRequests, Code: "too_many_requests", Message: message}
+}
+
+//newInternalError creates an error for a problem of the server, whose details are not shown to the client
+func newInternalError() error{
+	return &apiError{Status: http.StatusInternalServerError, Code: "internal_error", Message: "Internal server error"}
+}
+
+//writeError outputs the given error as JSON data with its HTTP status.
+//Errors that are not an apiError are logged and given to the client as an internal error
+func writeError(w http.ResponseWriter, r *http.Request, err error){
+	id := requestID(r)
+	clientError := clientErrorOf(r, err)
+	traceEvent(r.Context(), "error %d %s: %s", clientError.Status, clientError.Code, clientError.Message)
+
+	//The validators and the Cache-Control of the catalog are set before the handler runs, but they belong to its representation,
+	//an error is not cached and it does not last as long as the revision of the catalog
+	w.Header().Del("ETag")
+	w.Header().Del("Last-Modified")
+	w.Header().Set("Cache-Control", "no-store")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(requestIDHeader, id)
+	w.WriteHeader(clientError.Status)
+	w.Write(errorDocument(r, clientError, id))
+}
+
+//clientErrorOf gives the error that is shown to the client. Errors other than the API errors are logged
+//and shown as internal errors, so their details are not revealed
+func clientErrorOf(r *http.Request, err error) *apiError{
+	if clientError, isClientError := err.(*apiError); isClientError {
+		return clientError
+	}
+
+	logMessage("error", "Something went wrong processing the request " + requestID(r) + ": " + r.Method + " " + r.URL.Path)
+	logMessage("error", err)
+
+	return newInternalError().(*apiError)
+}
+
+//errorDocument gives the JSON of an error in the version of the API asked by the request
+func errorDocument(r *http.Request, clientError *apiError, id string) []byte{
+	if apiVersion(r) == 2 {
+		jsonResponse, _ := json.Marshal(ErrorDocumentV2{
+			Error: ErrorDetailV2{Code: clientError.Code, Message: clientError.Message},
+			Meta: MetaV2{APIVersion: 2, RequestID: id},
+		})
+		return jsonResponse
+	}
+
+	jsonResponse, _ := json.Marshal(ErrorResponse {
+		Error: ErrorDetail {
+			Code: clientError.Code,
+			Message: clientError.Message,
+			RequestID: id,
+		},
+	})
+	return jsonResponse
+}
+
+//notFound outputs the error for the routes that are not handled by the API
+func notFound(w http.ResponseWriter, r *http.Request){
+	writeError(w, r, newNotFoundError("Route not found: " + r.Method + " " + r.URL.Path))
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+
+	"net/http"
+)
+
+/* Types */
+
+//responseFormat is an encoding of the results that the clients can ask for
+type responseFormat struct{
+	Name string
+	ContentType string
+	MediaTypes []string
+	Disposition string
+}
+
+//xmlListV2 holds the items of a list in the data of a document of the version 2 in XML
+type xmlListV2 struct{
+	Items []interface{} `xml:"item"`
+}
+
+/* Formats */
+
+//responseFormats lists the formats of the results, the first one is used when the client accepts any format
+var responseFormats = []responseFormat{
+	{"json", "application/json", []string{"application/json"}, "inline"},
+	{"ndjson", "application/x-ndjson", []string{"application/x-ndjson", "application/ndjson"}, "inline"},
+	{"csv", "text/csv; charset=utf-8", []string{"text/csv"}, "attachment"},
+	{"xml", "application/xml; charset=utf-8", []string{"application/xml", "text/xml"}, "inline"},
+}
+
+/* Route Wrapper */
+
+//negotiatedRoute answers with an error the requests that ask for a format of the results that can not be given,
+//before the handler reads or changes the database
+func negotiatedRoute(handler http.HandlerFunc) http.HandlerFunc{
+	return func(w http.ResponseWriter, r *http.Request){
+		if _, formatError := negotiateFormat(r); formatError != nil {
+			writeError(w, r, formatError)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+/* Format Functions */
+
+//negotiateFormat chooses the format of the results from the format parameter, or from the Accept header when it is not given.
+//An unknown format parameter is a bad request, and an Accept header that has none of the formats is not acceptable
+func negotiateFormat(r *http.Request) (responseFormat, error){
+	if name := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format"))); name != "" {
+		for _, format := range responseFormats {
+			if format.Name == name {
+				return format, nil
+			}
+		}
+		return responseFormat{}, newBadRequestError("Unknown format: " + name + ", it has to be json, ndjson, csv or xml")
+	}
+
+	accept := strings.TrimSpace(r.Header.Get("Accept"))
+	if accept == "" {
+		return responseFormats[0], nil
+	}
+
+	//The media types are tried from the highest to the lowest quality, keeping the order of the header for the same quality
+	type acceptedType struct{
+		MediaType string
+		Quality float64
+	}
+	accepted := []acceptedType{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, parseError := mime.ParseMediaType(part)
+		if parseError != nil {
+			continue
+		}
+
+		quality := 1.0
+		if value, hasQuality := params["q"]; hasQuality {
+			if parsed, qualityError := strconv.ParseFloat(value, 64); qualityError == nil {
+				quality = parsed
+			}
+		}
+		if quality > 0 {
+			accepted = append(accepted, acceptedType{mediaType, quality})
+		}
+	}
+	sort.SliceStable(accepted, func(first int, second int) bool{
+		return accepted[first].Quality > accepted[second].Quality
+	})
+
+	for _, current := range accepted {
+		for _, format := range responseFormats {
+			for _, mediaType := range format.MediaTypes {
+				if current.MediaType == mediaType || current.MediaType == "*/*" || current.MediaType == strings.SplitN(mediaType, "/", 2)[0] + "/*" {
+					return format, nil
+				}
+			}
+		}
+	}
+
+	return responseFormat{}, newNotAcceptableError("None of the accepted media types can be given: " + accept +
+		", they have to be application/json, application/x-ndjson, text/csv or application/xml")
+}
+
+//encodeResult encodes the value of a response in the given format other than JSON.
+//The items of the lists and the single songs and genres are encoded in the fields of the version asked by the request
+func encodeResult(r *http.Request, format responseFormat, value interface{}, links map[string]string) ([]byte, error){
+	version := apiVersion(r)
+	items, isList := resultItems(value)
+	if version == 2 {
+		for index, item := range items {
+			items[index] = itemV2(item)
+		}
+	}
+
+	buffer := &bytes.Buffer{}
+
+	switch format.Name {
+	case "ndjson":
+		encoder := json.NewEncoder(buffer)
+		for _, item := range items {
+			if encodeError := encoder.Encode(item); encodeError != nil {
+				return nil, encodeError
+			}
+		}
+
+	case "csv":
+		writer := csv.NewWriter(buffer)
+		writer.Write(csvHeader(value, version))
+		for _, item := range items {
+			writer.Write(csvRecord(item))
+		}
+		writer.Flush()
+		if csvError := writer.Error(); csvError != nil {
+			return nil, csvError
+		}
+
+	case "xml":
+		var document interface{} = value
+		if version == 2 {
+			documentValue := documentV2(r, value, links)
+			if isList {
+				documentValue.Data = xmlListV2{Items: items}
+			}
+			document = documentValue
+		}
+
+		buffer.WriteString(xml.Header)
+		if xmlError := xml.NewEncoder(buffer).Encode(document); xmlError != nil {
+			return nil, xmlError
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+//resultItems gives the items of a list, or the value itself when it is not a list, and tells if the value is a list
+func resultItems(value interface{}) ([]interface{}, bool){
+	items := []interface{}{}
+
+	switch typed := value.(type) {
+	case SongsList:
+		for _, song := range typed.Songs {
+			items = append(items, song)
+		}
+	case SearchResultsList:
+		for _, result := range typed.Results {
+			items = append(items, result)
+		}
+	case GenresList:
+		for _, genre := range typed.Genres {
+			items = append(items, genre)
+		}
+	default:
+		return append(items, value), false
+	}
+
+	return items, true
+}
+
+//itemV2 converts an item of a response to the version 2
+func itemV2(item interface{}) interface{}{
+	switch typed := item.(type) {
+	case Song:
+		return songV2(typed)
+	case SearchResult:
+		return searchResultV2(typed)
+	case Genre:
+		return genreV2(typed)
+	}
+	return item
+}
+
+//csvHeader gives the names of the columns of the value in CSV, which are the names of its fields in the JSON of the version
+func csvHeader(value interface{}, version int) []string{
+	switch value.(type) {
+	case Song, SongsList:
+		if version == 2 {
+			return []string{"id", "artist", "song", "genre", "length"}
+		}
+		return []string{"ID", "Artist", "Song", "Genre", "Length"}
+
+	case SearchResultsList:
+		if version == 2 {
+			return []string{"id", "artist", "song", "genre", "length", "score"}
+		}
+		return []string{"ID", "Artist", "Song", "Genre", "Length", "Score"}
+
+	case Genre, GenresList:
+		if version == 2 {
+			return []string{"name", "number_of_songs", "total_length"}
+		}
+		return []string{"Genre", "NumberOfSongs", "TotalLength"}
+	}
+	return []string{}
+}
+
+//csvRecord gives the values of the columns of an item in CSV
+func csvRecord(item interface{}) []string{
+	switch typed := item.(type) {
+	case Song:
+		return []string{strconv.Itoa(typed.ID), typed.Artist, typed.Song, typed.Genre, strconv.Itoa(typed.Length)}
+	case SongV2:
+		return csvRecord(Song(typed))
+	case SearchResult:
+		return append(csvRecord(typed.Song), strconv.FormatFloat(typed.Score, 'g', -1, 64))
+	case SearchResultV2:
+		return append(csvRecord(typed.SongV2), strconv.FormatFloat(typed.Score, 'g', -1, 64))
+	case Genre:
+		return []string{typed.Genre, strconv.Itoa(typed.NumberOfSongs), strconv.Itoa(typed.TotalLength)}
+	case GenreV2:
+		return []string{typed.Name, strconv.Itoa(typed.NumberOfSongs), strconv.Itoa(typed.TotalLength)}
+	}
+	return []string{}
+}
+
+//resultFileName gives the name of the file of a response, after the resource of the route, like songs.csv
+func resultFileName(r *http.Request, format responseFormat) string{
+	resource := strings.SplitN(strings.TrimPrefix(unversionedPattern(matchedPattern(r)), "/"), "/", 2)[0]
+	if resource == "" {
+		resource = "result"
+	}
+	return resource + "." + format.Name
+}
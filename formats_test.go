@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"net/http"
+	"net/http/httptest"
+)
+
+/* Format Tests */
+
+func TestNegotiateFormat(t *testing.T){
+	tests := []struct{
+		query string
+		accept string
+		format string
+		status int
+	}{
+		{"", "", "json", 0},
+		{"", "*/*", "json", 0},
+		{"", "application/json", "json", 0},
+		{"", "application/x-ndjson", "ndjson", 0},
+		{"", "application/ndjson", "ndjson", 0},
+		{"", "text/csv", "csv", 0},
+		{"", "text/xml", "xml", 0},
+		{"", "text/*", "csv", 0},
+		{"", "application/xml;q=0.5, text/csv", "csv", 0},
+		{"", "application/xml, text/csv", "xml", 0},
+		{"", "application/json;q=0, text/csv;q=0.1", "csv", 0},
+		{"", "text/html, application/xhtml+xml, */*;q=0.8", "json", 0},
+		{"", "invalid; ;, text/csv", "csv", 0},
+		{"", "image/png", "", http.StatusNotAcceptable},
+		{"", "application/json;q=0", "", http.StatusNotAcceptable},
+		{"?format=csv", "application/json", "csv", 0},
+		{"?format=XML", "", "xml", 0},
+		{"?format=yaml", "", "", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/songs" + test.query, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+
+		format, formatError := negotiateFormat(r)
+		if test.status != 0 {
+			if clientError, isAPIError := formatError.(*apiError); !isAPIError || clientError.Status != test.status {
+				t.Errorf("%q with Accept %q gave the error %v, the status %d expected", test.query, test.accept, formatError, test.status)
+			}
+			continue
+		}
+
+		if formatError != nil || format.Name != test.format {
+			t.Errorf("%q with Accept %q gave %q and the error %v, %q expected", test.query, test.accept, format.Name, formatError, test.format)
+		}
+	}
+}
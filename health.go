@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"context"
+	"runtime"
+	"time"
+
+	"net/http"
+)
+
+/* Build Information */
+
+//Build information, set when the project is built with:
+//go build -ldflags "-X main.buildVersion=1.2.0 -X main.buildCommit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var buildVersion = "dev"
+var buildCommit = "unknown"
+var buildDate = "unknown"
+
+//Longest time that the readiness checks wait for the database
+const readinessTimeout = 2 * time.Second
+
+/* Health Handlers */
+
+//healthz tells that the process is alive and serving requests
+func healthz(w http.ResponseWriter, r *http.Request){
+	writeJSON(w, r, http.StatusOK, HealthStatus{
+		Status: "ok",
+		Checks: []HealthCheck{},
+	})
+}
+
+//readyz tells if the server can answer the API requests: the database is reachable,
+//its schema has the version expected by this build and a query on the songs runs
+func (s *server) readyz(w http.ResponseWriter, r *http.Request){
+	checkContext, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := []HealthCheck{}
+	ready := true
+
+	addCheck := func(name string, checkError error){
+		check := HealthCheck{Name: name, Status: "ok"}
+		if checkError != nil {
+			check.Status, check.Message = "failed", checkError.Error()
+			ready = false
+		}
+		checks = append(checks, check)
+	}
+
+	//The database is reachable
+	pingError := s.database.PingContext(checkContext)
+	addCheck("database", pingError)
+
+	//The schema has the version of the last migration known by this build
+	var schemaError error
+	if pingError == nil {
+		var version int
+		version, schemaError = schemaVersionDB(checkContext, s.database)
+		if schemaError == nil && version != latestMigrationVersion() {
+			schemaError = fmt.Errorf("the schema version is %d and this build expects %d", version, latestMigrationVersion())
+		}
+	}else{
+		schemaError = fmt.Errorf("the database is not reachable")
+	}
+	addCheck("schema", schemaError)
+
+	//A trivial query runs
+	var queryError error
+	if pingError == nil {
+		var songs int
+		queryError = s.database.QueryRowContext(checkContext, "SELECT COUNT(*) FROM (SELECT ID FROM songs LIMIT 1)").Scan(&songs)
+	}else{
+		queryError = fmt.Errorf("the database is not reachable")
+	}
+	addCheck("query", queryError)
+
+	status, code := "ok", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, r, code, HealthStatus{
+		Status: status,
+		Checks: checks,
+	})
+}
+
+//version gives the build information of the server
+func version(w http.ResponseWriter, r *http.Request){
+	writeJSON(w, r, http.StatusOK, VersionInfo{
+		Version: buildVersion,
+		Commit: buildCommit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		SchemaVersion: latestMigrationVersion(),
+	})
+}
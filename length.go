@@ -0,0 +1,90 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/* Constants */
+
+//Value of a length bound that leaves that end of the range open
+const openLength = "*"
+
+//Formats accepted for a length besides raw seconds: minutes like 3:20, hours like 1:03:20 and ISO 8601 durations like PT3M20S
+var clockLengthFormat = regexp.MustCompile(`^(?:(\d{1,9}):)?(\d{1,9}):(\d{2})$`)
+var isoLengthFormat = regexp.MustCompile(`^P(?:(\d{1,9})D)?(?:T(?:(\d{1,9})H)?(?:(\d{1,9})M)?(?:(\d{1,9})S)?)?$`)
+
+/* Length Functions */
+
+//parseLengthRange parses the minimum and maximum lengths given in the route.
+//An open bound is given as -1
+func parseLengthRange(minLength string, maxLength string) (int, int, error){
+	minSeconds, minError := parseLengthBound(minLength, "minimum")
+	if minError != nil {
+		return 0, 0, minError
+	}
+
+	maxSeconds, maxError := parseLengthBound(maxLength, "maximum")
+	if maxError != nil {
+		return 0, 0, maxError
+	}
+
+	if minSeconds >= 0 && maxSeconds >= 0 && minSeconds > maxSeconds {
+		return 0, 0, newBadRequestError("The minimum length (" + minLength + ") can not be greater than the maximum length (" + maxLength + ")")
+	}
+
+	return minSeconds, maxSeconds, nil
+}
+
+//parseLengthBound parses one bound of a length range, the name of the bound is used in the error message
+func parseLengthBound(value string, name string) (int, error){
+	value = strings.TrimSpace(value)
+	if value == openLength {
+		return -1, nil
+	}
+
+	seconds, lengthError := parseLength(value)
+	if lengthError != nil {
+		return 0, newBadRequestError("Invalid " + name + " length: " + value +
+			". Use seconds like 200, minutes like 3:20, an ISO 8601 duration like PT3M20S or " + openLength + " to leave it open")
+	}
+
+	return seconds, nil
+}
+
+//parseLength gives the number of seconds of the given length
+func parseLength(value string) (int, error){
+
+	//Raw seconds
+	if seconds, numberError := strconv.Atoi(value); numberError == nil {
+		if seconds < 0 {
+			return 0, strconv.ErrRange
+		}
+		return seconds, nil
+	}
+
+	//Minutes and seconds, optionally preceded by hours
+	if parts := clockLengthFormat.FindStringSubmatch(value); parts != nil {
+		seconds := lengthPart(parts[1])*3600 + lengthPart(parts[2])*60 + lengthPart(parts[3])
+		if lengthPart(parts[3]) >= 60 || (parts[1] != "" && lengthPart(parts[2]) >= 60) {
+			return 0, strconv.ErrRange
+		}
+		return seconds, nil
+	}
+
+	//ISO 8601 duration, at least one of its parts has to be given
+	isoValue := strings.ToUpper(value)
+	if parts := isoLengthFormat.FindStringSubmatch(isoValue); parts != nil && isoValue != "P" && !strings.HasSuffix(isoValue, "T") {
+		seconds := lengthPart(parts[1])*86400 + lengthPart(parts[2])*3600 + lengthPart(parts[3])*60 + lengthPart(parts[4])
+		return seconds, nil
+	}
+
+	return 0, strconv.ErrSyntax
+}
+
+//lengthPart gives the number in a part of a length, an empty part is 0
+func lengthPart(part string) int{
+	number, _ := strconv.Atoi(part)
+	return number
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+)
+
+/* Length Tests */
+
+func TestParseLength(t *testing.T){
+	tests := []struct{
+		value string
+		seconds int
+		valid bool
+	}{
+		{"200", 200, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"3:20", 200, true},
+		{"1:03:20", 3800, true},
+		{"3:60", 0, false},
+		{"1:60:00", 0, false},
+		{"90:00", 5400, true},
+		{"PT3M20S", 200, true},
+		{"pt3m20s", 200, true},
+		{"PT1H", 3600, true},
+		{"P1D", 86400, true},
+		{"P1DT1S", 86401, true},
+		{"P", 0, false},
+		{"PT", 0, false},
+		{"P1DT", 0, false},
+		{"3m20s", 0, false},
+		{"", 0, false},
+	}
+
+	for _, test := range tests {
+		seconds, lengthError := parseLength(test.value)
+		if (lengthError == nil) != test.valid {
+			t.Errorf("parseLength(%q) gave the error %v, valid %v expected", test.value, lengthError, test.valid)
+			continue
+		}
+		if test.valid && seconds != test.seconds {
+			t.Errorf("parseLength(%q) gave %d seconds, %d expected", test.value, seconds, test.seconds)
+		}
+	}
+}
+
+func TestParseLengthRange(t *testing.T){
+	tests := []struct{
+		minLength string
+		maxLength string
+		minSeconds int
+		maxSeconds int
+		valid bool
+	}{
+		{"100", "200", 100, 200, true},
+		{"200", "200", 200, 200, true},
+		{"3:00", "PT4M", 180, 240, true},
+		{"*", "200", -1, 200, true},
+		{"100", "*", 100, -1, true},
+		{"*", "*", -1, -1, true},
+		{" * ", "300", -1, 300, true},
+		{"300", "200", 0, 0, false},
+		{"abc", "200", 0, 0, false},
+		{"100", "abc", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		minSeconds, maxSeconds, rangeError := parseLengthRange(test.minLength, test.maxLength)
+		if (rangeError == nil) != test.valid {
+			t.Errorf("parseLengthRange(%q, %q) gave the error %v, valid %v expected", test.minLength, test.maxLength, rangeError, test.valid)
+			continue
+		}
+		if !test.valid {
+			if _, isAPIError := rangeError.(*apiError); !isAPIError {
+				t.Errorf("parseLengthRange(%q, %q) gave the error %T, a bad request expected", test.minLength, test.maxLength, rangeError)
+			}
+			continue
+		}
+		if minSeconds != test.minSeconds || maxSeconds != test.maxSeconds {
+			t.Errorf("parseLengthRange(%q, %q) gave %d and %d, %d and %d expected",
+				test.minLength, test.maxLength, minSeconds, maxSeconds, test.minSeconds, test.maxSeconds)
+		}
+	}
+}
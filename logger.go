@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+)
+
+//Index in logLevels of the least important level that is logged
+var minimumLogLevel = 1
+
+//setLogLevel sets the least important level that is logged, one of logLevels
+func setLogLevel(level string){
+	minimumLogLevel = logLevelIndex(level)
+}
+
+//logMessage prints the given values in a line when the level is logged
+func logMessage(level string, values ...interface{}){
+	if logLevelIndex(level) < minimumLogLevel {
+		return
+	}
+
+	logLine(values...)
+}
+
+//logLine prints the given values in a line whatever the log level is, like the lines of the access log
+func logLine(values ...interface{}){
+	fmt.Println(values...)
+}
+
+//logLevelIndex gives the index of the level in logLevels, unknown levels are taken as errors
+func logLevelIndex(level string) int{
+	for index, known := range logLevels {
+		if level == known {
+			return index
+		}
+	}
+	return len(logLevels) - 1
+}
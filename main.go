@@ -2,6 +2,12 @@ package main
 
 import (
     "fmt"
+    "os"
+    "flag"
+    "time"
+    "context"
+    "syscall"
+    "os/signal"
 
     "net/http"
 
@@ -11,24 +17,213 @@ import (
 
 func main() {
 
-	fmt.Println("Server starts ...")
+	//Read the config from the flags, the environment and the config file
+	settings, args, configError := loadConfig(os.Args[1:])
+	if configError == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if configError != nil {
+		fmt.Println("Something went wrong reading the config")
+		fmt.Println(configError)
+		os.Exit(2)
+	}
+	setLogLevel(settings.LogLevel)
+
+	//Initilize and open the database shared by all the handlers
+	database, databaseError := initDatabase(settings.DatabasePath, settings.DatabaseBusyTimeout, settings.DatabaseMaxOpenConns)
+	if databaseError != nil {
+		fmt.Println("Something went wrong openning the database: " + settings.DatabasePath)
+		fmt.Println(databaseError)
+		os.Exit(1)
+	}
+
+	//The migrate command changes the schema and exits
+	if len(args) > 0 && args[0] == "migrate" {
+		status := migrateCommand(database, args[1:], settings.EnableSearch)
+		database.Close()
+		os.Exit(status)
+	}
+
+	//Bring the schema up to date before serving
+	if settings.AutoMigrate {
+		if _, migrateError := migrateUp(database, settings.EnableSearch); migrateError != nil {
+			fmt.Println("Something went wrong applying the migrations of the database")
+			fmt.Println(migrateError)
+			os.Exit(1)
+		}
+	}
+
+	//The apikey command manages the API keys and exits
+	if len(args) > 0 && args[0] == "apikey" {
+		status := apikeyCommand(database, args[1:])
+		database.Close()
+		os.Exit(status)
+	}
+
+	//The results of the catalog queries are cached until the catalog changes
+	if settings.QueryCacheSize > 0 {
+		catalogQueries = newQueryCache(settings.QueryCacheSize)
+	}
+
+	logMessage("info", "Server starts on " + settings.ListenAddress + " ...")
 
 	//Handlers
 	mux := goji.NewMux()
+	handlers := newServer(database)
+
+	//Middlewares, the first one wraps all the others
+	mux.Use(requestIDs)
+	if settings.EnableMetrics {
+		mux.Use(requestMetrics)
+	}
+	if settings.EnableTracing {
+		mux.Use(traceRequests)
+	}
+	if settings.AccessLog {
+		mux.Use(accessLog(settings.AccessLogSampleRate, settings.AccessLogRedact))
+	}
+	if settings.Compression {
+		mux.Use(compressResponses(settings.CompressionMinSize))
+	}
+	mux.Use(recoverPanics)
+	if len(settings.CORSAllowedOrigins) > 0 {
+		mux.Use(newCORSPolicy(settings.CORSAllowedOrigins, settings.CORSAllowedMethods, settings.CORSAllowedHeaders,
+			settings.CORSExposedHeaders, settings.CORSAllowCredentials, settings.CORSMaxAge).middleware)
+	}
+	var limiter *rateLimiter
+	if settings.RateLimit {
+		limiter = newRateLimiter(database, settings.RateLimitSearch, settings.RateLimitList, settings.DailyQuota)
+	}
+	if settings.RequireAPIKey {
+		if limiter != nil {
+			mux.Use(limiter.guardAuthentication)
+		}
+		mux.Use(handlers.authenticate)
+	}
+	if limiter != nil {
+		mux.Use(limiter.middleware)
+	}
+
+	//Health Handlers
+	mux.HandleFunc(pat.Get("/healthz"), healthz)
+	mux.HandleFunc(pat.Get("/readyz"), handlers.readyz)
+	mux.HandleFunc(pat.Get("/version"), version)
+	if settings.EnableMetrics {
+		mux.HandleFunc(pat.Get("/metrics"), handlers.metrics)
+	}
+	if settings.EnableTracing {
+		mux.HandleFunc(pat.Get("/debug/requests"), debugTraces)
+		mux.HandleFunc(pat.Get("/debug/events"), debugTraces)
+	}
+
+	//API Handlers, the routes without a prefix and the /v1 routes are the deprecated version 1
+	deprecated := func(handler http.HandlerFunc) http.Handler{
+		return deprecatedRoute(settings.V1Sunset, handler)
+	}
+	apiRoutes(mux, handlers, settings, "", deprecated)
+	apiRoutes(mux, handlers, settings, apiV1Prefix, deprecated)
+	apiRoutes(mux, handlers, settings, apiV2Prefix, func(handler http.HandlerFunc) http.Handler{
+		return handler
+	})
+
+	//Any other route is answered with a JSON error
+	mux.HandleFunc(pat.New("/*"), notFound)
+
+	//Host, port and timeouts of the server
+	httpServer := &http.Server{
+		Addr: settings.ListenAddress,
+		Handler: mux,
+		ReadTimeout: settings.ReadTimeout,
+		WriteTimeout: settings.WriteTimeout,
+		IdleTimeout: settings.IdleTimeout,
+	}
+
+	status := serveUntilSignal(httpServer, settings.ShutdownTimeout)
+
+	//The database is closed once no request is using it
+	if closeError := database.Close(); closeError != nil {
+		fmt.Println("Something went wrong closing the database")
+		fmt.Println(closeError)
+		status = 1
+	}
+
+	os.Exit(status)
+}
+
+//apiRoutes adds the songs, search and genres routes with the given prefix to the mux, each handler wrapped by the given function
+func apiRoutes(mux *goji.Mux, handlers *server, settings config, prefix string, wrap func(http.HandlerFunc) http.Handler){
+
+	//The format of the results is checked before the handler changes anything
+	handle := func(routePattern *pat.Pattern, handler http.HandlerFunc){
+		mux.Handle(routePattern, wrap(negotiatedRoute(handler)))
+	}
+
+	//The reads of the catalog answer the conditional requests
+	handleRead := func(routePattern *pat.Pattern, handler http.HandlerFunc){
+		handle(routePattern, handlers.conditionalRoute(settings.CacheControl, handler))
+	}
 
 	//Songs Handlers
-	mux.HandleFunc(pat.Get("/songs"), findAllSongs)
-	mux.HandleFunc(pat.Get("/songs/artist/:artist"), findSongByArtist)
-	mux.HandleFunc(pat.Get("/songs/song/:song"), findSongBySong)
-	mux.HandleFunc(pat.Get("/songs/genre/:genre"), findSongByGenre)
-	mux.HandleFunc(pat.Get("/songs/length/:minLength/:maxLength"), findSongByLength)
-	
+	handleRead(pat.Get(prefix + "/songs"), handlers.findAllSongs)
+	handleRead(pat.Get(prefix + "/songs/artist/:artist"), handlers.findSongByArtist)
+	handleRead(pat.Get(prefix + "/songs/song/:song"), handlers.findSongBySong)
+	handleRead(pat.Get(prefix + "/songs/genre/:genre"), handlers.findSongByGenre)
+	handleRead(pat.Get(prefix + "/songs/length/:minLength/:maxLength"), handlers.findSongByLength)
+	handleRead(pat.Get(prefix + "/songs/:id"), handlers.findSongByID)
+	if settings.EnableWrites {
+		handle(pat.Post(prefix + "/songs"), handlers.createSong)
+		handle(pat.Put(prefix + "/songs/:id"), handlers.replaceSong)
+		handle(pat.Patch(prefix + "/songs/:id"), handlers.updateSong)
+		handle(pat.Delete(prefix + "/songs/:id"), handlers.deleteSong)
+	}
+
+	//Search Handlers
+	if settings.EnableSearch {
+		handleRead(pat.Get(prefix + "/search"), handlers.searchSongs)
+	}
+
 	//Genres Handlers
-	mux.HandleFunc(pat.Get("/genres"), findAllGenres)
-	
-	//Host and port of the server
-	http.ListenAndServe("localhost:8080", mux)
+	handleRead(pat.Get(prefix + "/genres"), handlers.findAllGenres)
+	if settings.EnableWrites {
+		handle(pat.Post(prefix + "/genres"), handlers.createGenre)
+		handle(pat.Put(prefix + "/genres/:genre"), handlers.renameGenre)
+		handle(pat.Delete(prefix + "/genres/:genre"), handlers.deleteGenre)
+	}
 }
 
+//serveUntilSignal serves the requests until the server fails or gets SIGINT or SIGTERM, then it waits up to
+//shutdownTimeout for the requests in flight. It gives 0 when the server stops cleanly and 1 otherwise
+func serveUntilSignal(httpServer *http.Server, shutdownTimeout time.Duration) int{
+	serverErrors := make(chan error, 1)
+	go func(){
+		serverErrors <- httpServer.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case serverError := <-serverErrors:
+		fmt.Println("Something went wrong serving on " + httpServer.Addr)
+		fmt.Println(serverError)
+		return 1
 
+	case received := <-signals:
+		logMessage("info", "Server stops after " + received.String() + ", waiting for the requests in flight ...")
+	}
 
+	//Stop accepting connections and wait for the requests in flight
+	shutdownContext, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if shutdownError := httpServer.Shutdown(shutdownContext); shutdownError != nil {
+		fmt.Println("Something went wrong waiting for the requests in flight, their connections are closed")
+		fmt.Println(shutdownError)
+		httpServer.Close()
+		return 1
+	}
+
+	logMessage("info", "Server stopped")
+	return 0
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"context"
 	"encoding/json"
 
 	"net/http"
@@ -11,125 +14,687 @@ import (
     _ "github.com/mattn/go-sqlite3"
 )
 
-//findAllSongs finds all the songs in the database
-func findAllSongs(w http.ResponseWriter, r *http.Request){
+//server holds the resources shared by all the handlers
+type server struct{
+	database *sql.DB
+}
 
-	//Initilize and open the database
-	database := initDatabase(databaseFilePath)
-	defer database.Close()
+//newServer creates the handlers that use the given database
+func newServer(database *sql.DB) *server{
+	return &server{
+		database: database,
+	}
+}
 
-	//Get all songs in database
-    rows := findAllSongsDB(database)
+//findAllSongs finds all the songs in the database that match with every filter given in the query:
+//artist, song, genre, minLength and maxLength. Without filters all the songs are found
+func (s *server) findAllSongs(w http.ResponseWriter, r *http.Request){
+
+	//Get the filters
+	filter, filterError := parseSongFilter(r)
+	if filterError != nil {
+		writeError(w, r, filterError)
+		return
+	}
+
+	//Get the paging and sorting options
+	options, optionsError := parseListOptions(r)
+	if optionsError != nil {
+		writeError(w, r, optionsError)
+		return
+	}
+
+	//Get the songs in database that match with the filters
+    rows, total, rowsError := findSongsDB(r.Context(), s.database, filter, options)
+    if rowsError != nil {
+    	writeError(w, r, rowsError)
+    	return
+    }
     defer rows.Close()
  
-    //Output the resulted rows as JSON data
-    printResultAsJSON(w, rows)
+    //Stream the resulted rows to the response
+    streamSongs(w, r, rows, total, options)
 }
 
 //findSongByArtist finds all the songs in the database that match with the given artist
-func findSongByArtist(w http.ResponseWriter, r *http.Request){
+func (s *server) findSongByArtist(w http.ResponseWriter, r *http.Request){
+
+	//Get the paging and sorting options
+	options, optionsError := parseListOptions(r)
+	if optionsError != nil {
+		writeError(w, r, optionsError)
+		return
+	}
 
 	//Get the parameter value
 	artist := pat.Param(r, "artist")
 
-	//Initilize and open the database
-	database := initDatabase(databaseFilePath)
-	defer database.Close()
-
 	//Get the songs in database that match with the given artist
-    rows := findSongByArtistDB(database, artist)
+    rows, total, rowsError := findSongByArtistDB(r.Context(), s.database, artist, options)
+    if rowsError != nil {
+    	writeError(w, r, rowsError)
+    	return
+    }
     defer rows.Close()
  
-    //Output the resulted rows as JSON data
-    printResultAsJSON(w, rows)
+    //Stream the resulted rows to the response
+    streamSongs(w, r, rows, total, options)
 }
 
 //findSongBySong finds all the songs in the database that match with the given song
-func findSongBySong(w http.ResponseWriter, r *http.Request){
+func (s *server) findSongBySong(w http.ResponseWriter, r *http.Request){
+
+	//Get the paging and sorting options
+	options, optionsError := parseListOptions(r)
+	if optionsError != nil {
+		writeError(w, r, optionsError)
+		return
+	}
 
 	//Get the parameter value
 	song := pat.Param(r, "song")
 
-	//Initilize and open the database
-	database := initDatabase(databaseFilePath)
-	defer database.Close()
-
 	//Get the songs in database that match with the given song
-    rows := findSongBySongDB(database, song)
+    rows, total, rowsError := findSongBySongDB(r.Context(), s.database, song, options)
+    if rowsError != nil {
+    	writeError(w, r, rowsError)
+    	return
+    }
     defer rows.Close()
  
-    //Output the resulted rows as JSON data
-    printResultAsJSON(w, rows)
+    //Stream the resulted rows to the response
+    streamSongs(w, r, rows, total, options)
 }
 
 //findSongByGenre finds all the songs in the database that match with the given genre
-func findSongByGenre(w http.ResponseWriter, r *http.Request){
+func (s *server) findSongByGenre(w http.ResponseWriter, r *http.Request){
+
+	//Get the paging and sorting options
+	options, optionsError := parseListOptions(r)
+	if optionsError != nil {
+		writeError(w, r, optionsError)
+		return
+	}
 
 	//Get the parameter value
 	genre := pat.Param(r, "genre")
 
-	//Initilize and open the database
-	database := initDatabase(databaseFilePath)
-	defer database.Close()
-
 	//Get the songs in database that match with the given genre
-    rows := findSongByGenreDB(database, genre)
+    rows, total, rowsError := findSongByGenreDB(r.Context(), s.database, genre, options)
+    if rowsError != nil {
+    	writeError(w, r, rowsError)
+    	return
+    }
     defer rows.Close()
  
-    //Output the resulted rows as JSON data
-    printResultAsJSON(w, rows)
+    //Stream the resulted rows to the response
+    streamSongs(w, r, rows, total, options)
 }
 
 //findSongByLength finds all the songs in the database that have a length between a minimum and maximum
-func findSongByLength(w http.ResponseWriter, r *http.Request){
-
-	//Get the parameter values
-	minLength := pat.Param(r, "minLength")
-	maxLength := pat.Param(r, "maxLength")
-
-	//Initilize and open the database
-	database := initDatabase(databaseFilePath)
-	defer database.Close()
+func (s *server) findSongByLength(w http.ResponseWriter, r *http.Request){
+
+	//Get the paging and sorting options
+	options, optionsError := parseListOptions(r)
+	if optionsError != nil {
+		writeError(w, r, optionsError)
+		return
+	}
+
+	//Get and check the parameter values
+	minLength, maxLength, lengthError := parseLengthRange(pat.Param(r, "minLength"), pat.Param(r, "maxLength"))
+	if lengthError != nil {
+		writeError(w, r, lengthError)
+		return
+	}
 
 	//Get the songs in database that match with the given genre
-    rows := findSongByLengthDB(database, minLength, maxLength)
+    rows, total, rowsError := findSongByLengthDB(r.Context(), s.database, minLength, maxLength, options)
+    if rowsError != nil {
+    	writeError(w, r, rowsError)
+    	return
+    }
     defer rows.Close()
  
-    //Output the resulted rows as JSON data
-    printResultAsJSON(w, rows)
+    //Stream the resulted rows to the response
+    streamSongs(w, r, rows, total, options)
 }
 
-//findAllGenres finds all the genres in the database and gives the number of songs and the total length of all songs by genre
-func findAllGenres(w http.ResponseWriter, r *http.Request){
+//searchSongs finds the songs in the database whose artist, song or genre match with the text given in the q parameter,
+//sorted by their relevance
+func (s *server) searchSongs(w http.ResponseWriter, r *http.Request){
+
+	//Get the search and paging parameters
+	query, queryError := parseSearchQuery(r.URL.Query().Get("q"))
+	if queryError != nil {
+		writeError(w, r, queryError)
+		return
+	}
+
+	limit, offset, limitsError := parsePageLimits(r.URL.Query())
+	if limitsError != nil {
+		writeError(w, r, limitsError)
+		return
+	}
+
+	//Get the songs in database that match with the search
+	rows, total, rowsError := searchSongsDB(r.Context(), s.database, query, limit, offset)
+	if rowsError != nil {
+		writeError(w, r, rowsError)
+		return
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		result := SearchResult{}
+
+		var rank float64
+		resultError := rows.Scan(
+			&result.ID,
+			&result.Artist,
+			&result.Song.Song,
+			&result.Genre,
+			&result.Length,
+			&rank,
+			&result.Highlights.Artist,
+			&result.Highlights.Song,
+			&result.Highlights.Genre)
+
+		if resultError != nil {
+			writeError(w, r, resultError)
+			return
+		}
+
+		//BM25 gives lower values to the better matches
+		result.Score = -rank
+
+		result.Highlights.Artist = highlightText(result.Highlights.Artist)
+		result.Highlights.Song = highlightText(result.Highlights.Song)
+		result.Highlights.Genre = highlightText(result.Highlights.Genre)
+
+		results = append(results, result)
+	}
+	if rowsError := rows.Err(); rowsError != nil {
+		writeError(w, r, rowsError)
+		return
+	}
+
+	//Output the results as JSON data
+	links := pageLinks(r, listOptions{Limit: limit, Offset: offset}, total, pageBounds{})
+	writePageHeaders(w, total, links)
+	writeResultPage(w, r, SearchResultsList{
+		Results: results,
+		Total: total,
+	}, links)
+}
 
-	//Initilize and open the database
-	database := initDatabase(databaseFilePath)
-	defer database.Close()
+//findAllGenres finds all the genres in the database and gives the number of songs and the total length of all songs by genre
+func (s *server) findAllGenres(w http.ResponseWriter, r *http.Request){
 
 	//Get all songs in database
-    rows := findAllGenresDB(database)
+    rows, rowsError := findAllGenresDB(r.Context(), s.database)
+    if rowsError != nil {
+    	writeError(w, r, rowsError)
+    	return
+    }
     defer rows.Close()
  
-    //Output the resulted rows as JSON data
-    //Encode rows into JSON data
-    jsonResponse := genreRowsToJSON(rows)
+    //Read the genres in the rows
+    genres, genresError := genreRowsToList(rows)
+    if genresError != nil {
+    	writeError(w, r, genresError)
+    	return
+    }
+
+    //Output the genres as JSON data
+    writeResult(w, r, http.StatusOK, GenresList{
+    	Genres: genres,
+    })
+}
+
+
+//findSongByID finds the song in the database that has the given ID
+func (s *server) findSongByID(w http.ResponseWriter, r *http.Request){
+
+	//Get the parameter value
+	id, idError := songIDParam(r)
+	if idError != nil {
+		writeError(w, r, idError)
+		return
+	}
+
+	//Get the song in database that has the given ID
+	song, songError := findSongByIDDB(r.Context(), s.database, id)
+	if songError == sql.ErrNoRows {
+		writeError(w, r, newNotFoundError(fmt.Sprintf("Song not found: %d", id)))
+		return
+	}
+	if songError != nil {
+		writeError(w, r, songError)
+		return
+	}
+
+	//Output the song as JSON data
+	writeResult(w, r, http.StatusOK, song)
+}
+
+//createSong adds the song given in the request body to the database
+func (s *server) createSong(w http.ResponseWriter, r *http.Request){
+
+	//Decode the song from the request body
+	song := Song{}
+	if decodeError := json.NewDecoder(r.Body).Decode(&song); decodeError != nil {
+		writeError(w, r, newBadRequestError("Invalid song: " + decodeError.Error()))
+		return
+	}
+
+	//Check the song and resolve its genre
+	genreID, songError := validateSong(r.Context(), s.database, song)
+	if songError != nil {
+		writeError(w, r, songError)
+		return
+	}
+
+	//Insert the song in database
+	id, insertError := insertSongDB(r.Context(), s.database, song, genreID)
+	if insertError != nil {
+		writeError(w, r, insertError)
+		return
+	}
+
+	//Read the song back to output it as it is stored
+	song, songError = findSongByIDDB(r.Context(), s.database, id)
+	if songError != nil {
+		writeError(w, r, songError)
+		return
+	}
+
+	location := fmt.Sprintf("%s/songs/%d", apiPrefix(r), id)
+	w.Header().Set("Location", location)
+	writeResultWithLinks(w, r, http.StatusCreated, song, map[string]string{"self": location})
+}
+
+//replaceSong replaces every field of the song in the database that has the given ID
+func (s *server) replaceSong(w http.ResponseWriter, r *http.Request){
+	s.saveSong(w, r, false)
+}
+
+//updateSong changes only the fields given in the request body of the song in the database that has the given ID
+func (s *server) updateSong(w http.ResponseWriter, r *http.Request){
+	s.saveSong(w, r, true)
+}
+
+//saveSong stores the song given in the request body over the song in the database that has the given ID.
+//When partial is true the request body is applied on top of the stored song
+func (s *server) saveSong(w http.ResponseWriter, r *http.Request, partial bool){
 
-    //Format the JSON into string and write the result to w  
-    fmt.Fprintf(w, string(jsonResponse))
+	//Get the parameter value
+	id, idError := songIDParam(r)
+	if idError != nil {
+		writeError(w, r, idError)
+		return
+	}
+
+	//Get the stored song to check that it exists
+	song, songError := findSongByIDDB(r.Context(), s.database, id)
+	if songError == sql.ErrNoRows {
+		writeError(w, r, newNotFoundError(fmt.Sprintf("Song not found: %d", id)))
+		return
+	}
+	if songError != nil {
+		writeError(w, r, songError)
+		return
+	}
+
+	//Decode the song from the request body
+	if !partial {
+		song = Song{}
+	}
+	if decodeError := json.NewDecoder(r.Body).Decode(&song); decodeError != nil {
+		writeError(w, r, newBadRequestError("Invalid song: " + decodeError.Error()))
+		return
+	}
+
+	//Check the song and resolve its genre
+	genreID, songError := validateSong(r.Context(), s.database, song)
+	if songError != nil {
+		writeError(w, r, songError)
+		return
+	}
+
+	//Update the song in database
+	updatedSongs, updateError := updateSongDB(r.Context(), s.database, id, song, genreID)
+	if updateError != nil {
+		writeError(w, r, updateError)
+		return
+	}
+	if updatedSongs == 0 {
+		writeError(w, r, newNotFoundError(fmt.Sprintf("Song not found: %d", id)))
+		return
+	}
+
+	//Read the song back to output it as it is stored
+	song, songError = findSongByIDDB(r.Context(), s.database, id)
+	if songError != nil {
+		writeError(w, r, songError)
+		return
+	}
+
+	writeResult(w, r, http.StatusOK, song)
+}
+
+//deleteSong deletes the song in the database that has the given ID
+func (s *server) deleteSong(w http.ResponseWriter, r *http.Request){
+
+	//Get the parameter value
+	id, idError := songIDParam(r)
+	if idError != nil {
+		writeError(w, r, idError)
+		return
+	}
+
+	//Delete the song in database
+	deletedSongs, deleteError := deleteSongDB(r.Context(), s.database, id)
+	if deleteError != nil {
+		writeError(w, r, deleteError)
+		return
+	}
+	if deletedSongs == 0 {
+		writeError(w, r, newNotFoundError(fmt.Sprintf("Song not found: %d", id)))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//songIDParam gets the song ID given in the route
+func songIDParam(r *http.Request) (int, error){
+	id, idError := strconv.Atoi(pat.Param(r, "id"))
+	if idError != nil || id <= 0 {
+		return 0, newBadRequestError("Invalid song ID: " + pat.Param(r, "id"))
+	}
+
+	return id, nil
+}
+
+//parseSongFilter gets the song filters given in the query of the request
+func parseSongFilter(r *http.Request) (songFilter, error){
+	query := r.URL.Query()
+
+	filter := newSongFilter()
+	filter.Artist = strings.TrimSpace(query.Get("artist"))
+	filter.Song = strings.TrimSpace(query.Get("song"))
+	filter.Genre = strings.TrimSpace(query.Get("genre"))
+
+	//A length that is not given leaves that end of the range open
+	minLength, maxLength := query.Get("minLength"), query.Get("maxLength")
+	if minLength == "" {
+		minLength = openLength
+	}
+	if maxLength == "" {
+		maxLength = openLength
+	}
+
+	var lengthError error
+	filter.MinLength, filter.MaxLength, lengthError = parseLengthRange(minLength, maxLength)
+
+	return filter, lengthError
+}
+
+//validateSong checks the fields of the given song and gives the ID of its genre
+func validateSong(ctx context.Context, database *sql.DB, song Song) (int, error){
+	if strings.TrimSpace(song.Artist) == "" {
+		return 0, newBadRequestError("The artist of the song is required")
+	}
+	if strings.TrimSpace(song.Song) == "" {
+		return 0, newBadRequestError("The name of the song is required")
+	}
+	if strings.TrimSpace(song.Genre) == "" {
+		return 0, newBadRequestError("The genre of the song is required")
+	}
+	if song.Length < 0 {
+		return 0, newBadRequestError("The length of the song can not be negative")
+	}
+
+	//Resolve the genre by its name or ID
+	genreID, genreError := findGenreIDDB(ctx, database, strings.TrimSpace(song.Genre))
+	if genreError == sql.ErrNoRows {
+		return 0, newBadRequestError("Genre not found: " + song.Genre)
+	}
+
+	return genreID, genreError
+}
+
+//writeJSON encodes the given value into JSON data and writes it to w with the given status
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, value interface{}){
+	jsonResponse, _ := json.Marshal(value)
+	traceEvent(r.Context(), "encoded %d bytes of JSON", len(jsonResponse))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonResponse)
+}
+
+//writeResult writes a song, a genre or a list of them with the given status, in the format asked by the request
+func writeResult(w http.ResponseWriter, r *http.Request, status int, value interface{}){
+	writeResultWithLinks(w, r, status, value, nil)
+}
+
+//writeResultPage writes a page of a list with the status 200 and the links to the next and previous pages
+func writeResultPage(w http.ResponseWriter, r *http.Request, value interface{}, links map[string]string){
+	writeResultWithLinks(w, r, http.StatusOK, value, links)
+}
+
+//writeResultWithLinks encodes the given value in the format asked by the request, JSON by default, and writes it to w with the given status.
+//The JSON responses of the version 2 wrap the value in a document with the given links
+func writeResultWithLinks(w http.ResponseWriter, r *http.Request, status int, value interface{}, links map[string]string){
+	w.Header().Add("Vary", "Accept")
+
+	format, formatError := negotiateFormat(r)
+	if formatError != nil {
+		writeError(w, r, formatError)
+		return
+	}
+
+	var response []byte
+	if format.Name == "json" {
+		if apiVersion(r) == 2 {
+			value = documentV2(r, value, links)
+		}
+		response, _ = json.Marshal(value)
+	}else{
+		var encodeError error
+		if response, encodeError = encodeResult(r, format, value, links); encodeError != nil {
+			writeError(w, r, encodeError)
+			return
+		}
+	}
+	traceEvent(r.Context(), "encoded %d bytes of %s", len(response), format.Name)
+
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", format.Disposition + "; filename=\"" + resultFileName(r, format) + "\"")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+//createGenre adds the genre given in the request body to the database
+func (s *server) createGenre(w http.ResponseWriter, r *http.Request){
+
+	//Decode the genre name from the request body
+	name, nameError := decodeGenreName(r)
+	if nameError != nil {
+		writeError(w, r, nameError)
+		return
+	}
+
+	//Check that there is no other genre with the same name
+	_, genreError := findGenreIDDB(r.Context(), s.database, name)
+	if genreError == nil {
+		writeError(w, r, newConflictError("The genre already exists: " + name))
+		return
+	}
+	if genreError != sql.ErrNoRows {
+		writeError(w, r, genreError)
+		return
+	}
+
+	//Insert the genre in database
+	id, insertError := insertGenreDB(r.Context(), s.database, name)
+	if insertError != nil {
+		writeError(w, r, insertError)
+		return
+	}
+
+	//Read the genre back to output it as it is stored
+	genre, genreError := findGenreByIDDB(r.Context(), s.database, id)
+	if genreError != nil {
+		writeError(w, r, genreError)
+		return
+	}
+
+	writeResult(w, r, http.StatusCreated, genre)
 }
 
+//renameGenre changes the name of the genre in the database that match with the given name or ID
+func (s *server) renameGenre(w http.ResponseWriter, r *http.Request){
+
+	//Decode the new genre name from the request body
+	name, nameError := decodeGenreName(r)
+	if nameError != nil {
+		writeError(w, r, nameError)
+		return
+	}
+
+	//Get the genre that has to be renamed
+	id, genreError := findGenreIDDB(r.Context(), s.database, pat.Param(r, "genre"))
+	if genreError == sql.ErrNoRows {
+		writeError(w, r, newNotFoundError("Genre not found: " + pat.Param(r, "genre")))
+		return
+	}
+	if genreError != nil {
+		writeError(w, r, genreError)
+		return
+	}
+
+	//Check that the new name is not used by another genre
+	otherID, genreError := findGenreIDDB(r.Context(), s.database, name)
+	if genreError == nil && otherID != id {
+		writeError(w, r, newConflictError("The genre already exists: " + name))
+		return
+	}
+	if genreError != nil && genreError != sql.ErrNoRows {
+		writeError(w, r, genreError)
+		return
+	}
+
+	//Update the genre in database
+	updatedGenres, updateError := renameGenreDB(r.Context(), s.database, id, name)
+	if updateError != nil {
+		writeError(w, r, updateError)
+		return
+	}
+	if updatedGenres == 0 {
+		writeError(w, r, newNotFoundError("Genre not found: " + pat.Param(r, "genre")))
+		return
+	}
+
+	//Read the genre back to output it as it is stored
+	genre, genreError := findGenreByIDDB(r.Context(), s.database, id)
+	if genreError != nil {
+		writeError(w, r, genreError)
+		return
+	}
+
+	writeResult(w, r, http.StatusOK, genre)
+}
 
-//printResultAsJSON outputs the resulted rows as JSON data
-func printResultAsJSON(w http.ResponseWriter, rows *sql.Rows){
-	//Encode rows into JSON data
-    jsonResponse := songRowsToJSON(rows)
+//deleteGenre deletes the genre in the database that match with the given name or ID.
+//The songs of the genre are moved to the genre given in the reassignTo query parameter,
+//without it the genre is only deleted when no song references it
+func (s *server) deleteGenre(w http.ResponseWriter, r *http.Request){
+
+	//Get the genre that has to be deleted
+	id, genreError := findGenreIDDB(r.Context(), s.database, pat.Param(r, "genre"))
+	if genreError == sql.ErrNoRows {
+		writeError(w, r, newNotFoundError("Genre not found: " + pat.Param(r, "genre")))
+		return
+	}
+	if genreError != nil {
+		writeError(w, r, genreError)
+		return
+	}
+
+	//Get the genre that receives the songs, if any
+	targetID := 0
+	if target := strings.TrimSpace(r.URL.Query().Get("reassignTo")); target != "" {
+		targetID, genreError = findGenreIDDB(r.Context(), s.database, target)
+		if genreError == sql.ErrNoRows {
+			writeError(w, r, newBadRequestError("Genre not found: " + target))
+			return
+		}
+		if genreError != nil {
+			writeError(w, r, genreError)
+			return
+		}
+		if targetID == id {
+			writeError(w, r, newBadRequestError("The songs can not be reassigned to the deleted genre"))
+			return
+		}
+	}
+
+	//Delete the genre in database
+	_, deleteError := deleteGenreDB(r.Context(), s.database, id, targetID)
+	if deleteError == errGenreInUse {
+		writeError(w, r, newConflictError(deleteError.Error() + ", use reassignTo to move them to another genre"))
+		return
+	}
+	if deleteError == sql.ErrNoRows {
+		writeError(w, r, newNotFoundError("Genre not found: " + pat.Param(r, "genre")))
+		return
+	}
+	if deleteError != nil {
+		writeError(w, r, deleteError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
 
-    //Format the JSON into string and write the result to w  
-    fmt.Fprintf(w, string(jsonResponse))
+//decodeGenreName gets the genre name given in the request body
+func decodeGenreName(r *http.Request) (string, error){
+	var name string
+
+	//The version 2 gives the name of the genre in the name field
+	if apiVersion(r) == 2 {
+		genre := GenreV2{}
+		if decodeError := json.NewDecoder(r.Body).Decode(&genre); decodeError != nil {
+			return "", newBadRequestError("Invalid genre: " + decodeError.Error())
+		}
+		name = genre.Name
+	}else{
+		genre := Genre{}
+		if decodeError := json.NewDecoder(r.Body).Decode(&genre); decodeError != nil {
+			return "", newBadRequestError("Invalid genre: " + decodeError.Error())
+		}
+		name = genre.Genre
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", newBadRequestError("The name of the genre is required")
+	}
+
+	//Numeric names would be confused with the genre IDs
+	if _, numberError := strconv.Atoi(name); numberError == nil {
+		return "", newBadRequestError("The name of the genre can not be a number")
+	}
+
+	return name, nil
 }
 
-//songRowsToJSON encodes the given rows into JSON data
-func songRowsToJSON(rows *sql.Rows) []byte{
+//songRowsToList reads the songs in the given rows
+func songRowsToList(rows resultRows) ([]Song, error){
 
 	songs := []Song {}
 
@@ -146,25 +711,18 @@ func songRowsToJSON(rows *sql.Rows) []byte{
     		&song.Length)
 
     	if songError != nil{
-    		fmt.Println("Something went wrong trying to get a song.")
-        	fmt.Println(songError)
+    		return nil, songError
     	}
 
     	songs = append(songs, song)
     }
 
-    songsListResult := SongsList {
-    	Songs: songs,
-    }
-
-    //Encode the Go array into JSON data
-    jsonResponse,_ := json.Marshal(songsListResult)
-
-    return jsonResponse
+    //Check that the iteration was not stopped by an error
+    return songs, rows.Err()
 }
 
-//genreRowsToJSON encodes the given rows into JSON data
-func genreRowsToJSON(rows *sql.Rows) []byte{
+//genreRowsToList reads the genres in the given rows
+func genreRowsToList(rows resultRows) ([]Genre, error){
 
 	genres := []Genre {}
 
@@ -179,19 +737,12 @@ func genreRowsToJSON(rows *sql.Rows) []byte{
     		&genre.TotalLength)
 
     	if genreError != nil{
-    		fmt.Println("Something went wrong trying to get a genre.")
-        	fmt.Println(genreError)
+    		return nil, genreError
     	}
 
     	genres = append(genres, genre)
     }
 
-    genresListResult := GenresList {
-    	Genres: genres,
-    }
-
-    //Encode the Go array into JSON data
-    jsonResponse,_ := json.Marshal(genresListResult)
-
-    return jsonResponse
+    //Check that the iteration was not stopped by an error
+    return genres, rows.Err()
 }
\ No newline at end of file
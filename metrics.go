@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"net/http"
+	"database/sql"
+)
+
+/* Constants */
+
+//Upper bounds in seconds of the buckets of the latency histograms
+var httpDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+var sqlDurationBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+/* Types */
+
+//histogram counts the observed values in cumulative buckets
+type histogram struct{
+	Counts []uint64
+	Sum float64
+	Count uint64
+}
+
+//metricFamily holds the values of a metric by their labels
+type metricFamily struct{
+	Name string
+	Help string
+	Type string
+	LabelNames []string
+	Buckets []float64
+
+	Counters map[string]float64
+	Histograms map[string]*histogram
+}
+
+//metricsRegistry holds the metrics of the server in memory
+type metricsRegistry struct{
+	mutex sync.Mutex
+	families []*metricFamily
+}
+
+/* Metrics */
+
+//appMetrics holds every metric collected by the server
+var appMetrics = &metricsRegistry{}
+
+var httpRequestsTotal = appMetrics.newFamily("bv_http_requests_total", "Number of HTTP requests by route pattern, method and status.",
+	"counter", nil, "pattern", "method", "status")
+var httpRequestDuration = appMetrics.newFamily("bv_http_request_duration_seconds", "Latency of the HTTP requests by route pattern, method and status.",
+	"histogram", httpDurationBuckets, "pattern", "method", "status")
+var sqlQueryDuration = appMetrics.newFamily("bv_sql_query_duration_seconds", "Duration of the database functions.",
+	"histogram", sqlDurationBuckets, "function")
+
+/* Registry Functions */
+
+//newFamily adds a metric to the registry
+func (registry *metricsRegistry) newFamily(name string, help string, metricType string, buckets []float64, labelNames ...string) *metricFamily{
+	family := &metricFamily{
+		Name: name,
+		Help: help,
+		Type: metricType,
+		LabelNames: labelNames,
+		Buckets: buckets,
+		Counters: map[string]float64{},
+		Histograms: map[string]*histogram{},
+	}
+
+	registry.families = append(registry.families, family)
+
+	return family
+}
+
+//add adds the value to the counter with the given label values
+func (registry *metricsRegistry) add(family *metricFamily, value float64, labelValues ...string){
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	family.Counters[metricLabels(family.LabelNames, labelValues)] += value
+}
+
+//observe records the value in the histogram with the given label values
+func (registry *metricsRegistry) observe(family *metricFamily, value float64, labelValues ...string){
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	labels := metricLabels(family.LabelNames, labelValues)
+	current, exists := family.Histograms[labels]
+	if !exists {
+		current = &histogram{Counts: make([]uint64, len(family.Buckets))}
+		family.Histograms[labels] = current
+	}
+
+	for index, bound := range family.Buckets {
+		if value <= bound {
+			current.Counts[index]++
+		}
+	}
+	current.Sum += value
+	current.Count++
+}
+
+//write writes every metric of the registry in the Prometheus text exposition format
+func (registry *metricsRegistry) write(w io.Writer){
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for _, family := range registry.families {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family.Name, family.Help, family.Name, family.Type)
+
+		if family.Type == "histogram" {
+			for _, labels := range sortedKeys(family.Histograms) {
+				current := family.Histograms[labels]
+				for index, bound := range family.Buckets {
+					fmt.Fprintf(w, "%s_bucket{%s} %d\n", family.Name, joinLabels(labels, "le=\"" + formatMetric(bound) + "\""), current.Counts[index])
+				}
+				fmt.Fprintf(w, "%s_bucket{%s} %d\n", family.Name, joinLabels(labels, "le=\"+Inf\""), current.Count)
+				fmt.Fprintf(w, "%s_sum%s %s\n", family.Name, wrapLabels(labels), formatMetric(current.Sum))
+				fmt.Fprintf(w, "%s_count%s %d\n", family.Name, wrapLabels(labels), current.Count)
+			}
+			continue
+		}
+
+		for _, labels := range sortedKeys(family.Counters) {
+			fmt.Fprintf(w, "%s%s %s\n", family.Name, wrapLabels(labels), formatMetric(family.Counters[labels]))
+		}
+	}
+}
+
+/* Metrics Functions */
+
+//observeQuery records the duration of a database function that started at the given time.
+//It is meant to be deferred at the start of the function, like defer observeQuery("findSongsDB", time.Now())
+func observeQuery(function string, start time.Time){
+	appMetrics.observe(sqlQueryDuration, time.Since(start).Seconds(), function)
+}
+
+//requestMetrics is a middleware that counts the requests and records their latency by route pattern, method and status
+func requestMetrics(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		if recorder.Status == 0 {
+			recorder.Status = http.StatusOK
+		}
+
+		route := matchedPattern(r)
+		status := strconv.Itoa(recorder.Status)
+		appMetrics.add(httpRequestsTotal, 1, route, r.Method, status)
+		appMetrics.observe(httpRequestDuration, time.Since(start).Seconds(), route, r.Method, status)
+	})
+}
+
+//metrics outputs the metrics of the server in the Prometheus text exposition format,
+//with the gauges of the database pool and of the catalog read when the request is made
+func (s *server) metrics(w http.ResponseWriter, r *http.Request){
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	appMetrics.write(w)
+	writeDatabaseGauges(w, s.database)
+	if catalogQueries != nil {
+		writeGauge(w, "bv_query_cache_entries", "Number of catalog query results in the query cache.", float64(catalogQueries.len()))
+	}
+}
+
+//writeDatabaseGauges writes the gauges and the wait counters of the database connection pool, and the size of the catalog
+func writeDatabaseGauges(w io.Writer, database *sql.DB){
+	stats := database.Stats()
+
+	writeGauge(w, "bv_db_open_connections", "Number of open database connections.", float64(stats.OpenConnections))
+	writeGauge(w, "bv_db_in_use_connections", "Number of database connections in use.", float64(stats.InUse))
+	writeGauge(w, "bv_db_idle_connections", "Number of idle database connections.", float64(stats.Idle))
+	writeCounter(w, "bv_db_wait_count_total", "Number of times a request waited for a database connection.", float64(stats.WaitCount))
+	writeCounter(w, "bv_db_wait_duration_seconds_total", "Total time waited for database connections.", stats.WaitDuration.Seconds())
+
+	//The gauges of the catalog are not written when the database can not be read
+	var songs, genres int
+	if countError := database.QueryRow("SELECT (SELECT COUNT(*) FROM songs), (SELECT COUNT(*) FROM genres)").Scan(&songs, &genres); countError != nil {
+		logMessage("warn", "Something went wrong counting the catalog for the metrics:", countError)
+		return
+	}
+
+	writeGauge(w, "bv_catalog_songs", "Number of songs in the catalog.", float64(songs))
+	writeGauge(w, "bv_catalog_genres", "Number of genres in the catalog.", float64(genres))
+}
+
+//writeGauge writes a gauge without labels
+func writeGauge(w io.Writer, name string, help string, value float64){
+	writeMetric(w, name, help, "gauge", value)
+}
+
+//writeCounter writes a counter without labels whose value is kept outside of the registry, like the waits of the database pool
+func writeCounter(w io.Writer, name string, help string, value float64){
+	writeMetric(w, name, help, "counter", value)
+}
+
+//writeMetric writes a metric without labels of the given type
+func writeMetric(w io.Writer, name string, help string, metricType string, value float64){
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, metricType, name, formatMetric(value))
+}
+
+//metricLabels gives the labels of a metric in the exposition format, like name="value",other="value"
+func metricLabels(names []string, values []string) string{
+	labels := make([]string, len(names))
+	for index, name := range names {
+		value := ""
+		if index < len(values) {
+			value = values[index]
+		}
+		value = strings.Replace(value, "\\", "\\\\", -1)
+		value = strings.Replace(value, "\"", "\\\"", -1)
+		value = strings.Replace(value, "\n", "\\n", -1)
+		labels[index] = name + "=\"" + value + "\""
+	}
+	return strings.Join(labels, ",")
+}
+
+//joinLabels adds a label to the labels of a metric
+func joinLabels(labels string, label string) string{
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+//wrapLabels puts the labels of a metric between braces, metrics without labels have no braces
+func wrapLabels(labels string) string{
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+//formatMetric formats a value of a metric
+func formatMetric(value float64) string{
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+//sortedKeys gives the keys of the map in order, so the metrics are always written in the same order
+func sortedKeys(values interface{}) []string{
+	keys := []string{}
+	switch typed := values.(type) {
+	case map[string]float64:
+		for key := range typed {
+			keys = append(keys, key)
+		}
+	case map[string]*histogram:
+		for key := range typed {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
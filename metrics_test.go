@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+/* Registry Tests */
+
+func TestMetricsRegistry(t *testing.T){
+	registry := &metricsRegistry{}
+	requests := registry.newFamily("test_requests_total", "Number of test requests.", "counter", nil, "method", "status")
+	latency := registry.newFamily("test_duration_seconds", "Latency of the test requests.", "histogram", []float64{0.1, 1}, "method")
+	registry.newFamily("test_unused_total", "A counter without values.", "counter", nil)
+
+	registry.add(requests, 1, "GET", "200")
+	registry.add(requests, 2, "GET", "200")
+	registry.add(requests, 1, "POST", "201")
+	registry.add(requests, 1, "GET", "quote\"back\\slash\nline")
+	registry.observe(latency, 0.05, "GET")
+	registry.observe(latency, 0.5, "GET")
+	registry.observe(latency, 5, "GET")
+
+	output := &bytes.Buffer{}
+	registry.write(output)
+
+	expected := []string{
+		"# HELP test_requests_total Number of test requests.",
+		"# TYPE test_requests_total counter",
+		`test_requests_total{method="GET",status="200"} 3`,
+		`test_requests_total{method="GET",status="quote\"back\\slash\nline"} 1`,
+		`test_requests_total{method="POST",status="201"} 1`,
+		"# HELP test_duration_seconds Latency of the test requests.",
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{method="GET",le="0.1"} 1`,
+		`test_duration_seconds_bucket{method="GET",le="1"} 2`,
+		`test_duration_seconds_bucket{method="GET",le="+Inf"} 3`,
+		`test_duration_seconds_sum{method="GET"} 5.55`,
+		`test_duration_seconds_count{method="GET"} 3`,
+		"# HELP test_unused_total A counter without values.",
+		"# TYPE test_unused_total counter",
+	}
+
+	if written := strings.TrimSpace(output.String()); written != strings.Join(expected, "\n") {
+		t.Errorf("the registry wrote:\n%s\n\nexpected:\n%s", written, strings.Join(expected, "\n"))
+	}
+}
+
+func TestWriteUnlabeledMetrics(t *testing.T){
+	tests := []struct{
+		write func(output *bytes.Buffer)
+		expected string
+	}{
+		{
+			func(output *bytes.Buffer){ writeGauge(output, "test_connections", "Open connections.", 3) },
+			"# HELP test_connections Open connections.\n# TYPE test_connections gauge\ntest_connections 3\n",
+		},
+		{
+			func(output *bytes.Buffer){ writeCounter(output, "test_wait_seconds_total", "Time waited.", 1.5) },
+			"# HELP test_wait_seconds_total Time waited.\n# TYPE test_wait_seconds_total counter\ntest_wait_seconds_total 1.5\n",
+		},
+	}
+
+	for _, test := range tests {
+		output := &bytes.Buffer{}
+		test.write(output)
+		if output.String() != test.expected {
+			t.Errorf("the metric was written as:\n%s\nexpected:\n%s", output.String(), test.expected)
+		}
+	}
+}
+
+func TestSongLookupQueryLabels(t *testing.T){
+	database := newTestDatabase(t)
+	ctx := context.Background()
+	options := listOptions{Limit: 10, Sort: "id"}
+
+	lookups := map[string]func() (resultRows, int, error){
+		"findSongByArtistDB": func() (resultRows, int, error){ return findSongByArtistDB(ctx, database, "The Beatles", options) },
+		"findSongBySongDB": func() (resultRows, int, error){ return findSongBySongDB(ctx, database, "Help!", options) },
+		"findSongByGenreDB": func() (resultRows, int, error){ return findSongByGenreDB(ctx, database, "Rock", options) },
+		"findSongByLengthDB": func() (resultRows, int, error){ return findSongByLengthDB(ctx, database, 100, 200, options) },
+	}
+
+	//Each lookup is recorded with its own name and not with the one of findSongsDB
+	for function, lookup := range lookups {
+		rows, _, rowsError := lookup()
+		if rowsError != nil {
+			t.Fatalf("%s failed: %v", function, rowsError)
+		}
+		rows.Close()
+	}
+
+	output := &bytes.Buffer{}
+	appMetrics.write(output)
+	for function := range lookups {
+		if series := `bv_sql_query_duration_seconds_count{function="` + function + `"}`; !strings.Contains(output.String(), series) {
+			t.Errorf("the metrics have no %s", series)
+		}
+	}
+}
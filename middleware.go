@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"context"
+	"runtime/debug"
+
+	"net/http"
+)
+
+/* Constants */
+
+//Header that carries the ID of a request, given by the client or generated by the server
+const requestIDHeader = "X-Request-ID"
+
+//IDs given by the clients are kept when they are short and only have visible ASCII characters, so they can be logged as they are
+var requestIDFormat = regexp.MustCompile(`^[\x21-\x7e]{1,128}$`)
+
+/* Types */
+
+//requestIDKey is the key of the request ID in the context of a request
+type requestIDKey struct{}
+
+/* Middlewares */
+
+//requestIDs gives each request the ID sent by the client in the X-Request-ID header or a new random ID.
+//The ID is kept in the context of the request, so the logs and the error bodies show it, and it is echoed in the response
+func requestIDs(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDFormat.MatchString(id) {
+			id = randomHex(8)
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+//recoverPanics answers with a JSON internal error when a handler panics, instead of closing the connection,
+//and logs the panic with its stack. A response that was already started can not be changed, it is only logged
+func recoverPanics(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		defer func(){
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			//The server aborts the response on purpose with this panic
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			logMessage("error", "Something went wrong, panic processing the request " + requestID(r) + ": " + r.Method + " " + r.URL.Path)
+			logMessage("error", fmt.Sprint(recovered) + "\n" + string(debug.Stack()))
+			traceEvent(r.Context(), "panic: %v", recovered)
+
+			if recorder.Status == 0 {
+				writeError(recorder, r, newInternalError())
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+/* Request ID Functions */
+
+//requestID gives the ID of the request, set by the requestIDs middleware, or a new random ID when the middleware was not used
+func requestID(r *http.Request) string{
+	if id, hasID := r.Context().Value(requestIDKey{}).(string); hasID {
+		return id
+	}
+
+	return randomHex(8)
+}
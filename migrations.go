@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"context"
+	"time"
+
+	"database/sql"
+)
+
+/* Types */
+
+//migration is a change of the database schema that can be applied and reverted.
+//A migration without Down can not be reverted, and a migration with a Module needs that SQLite module
+type migration struct{
+	Version int
+	Name string
+	Module string
+	Up string
+	Down string
+}
+
+//migrationStatus tells if a migration is applied in the database and when
+type migrationStatus struct{
+	Version int
+	Name string
+	Applied bool
+	AppliedAt string
+}
+
+/* Migrations */
+
+//migrations holds every change of the schema in the order they are applied.
+//A migration must never be changed once it is released, add a new one instead.
+//The first one adopts the songs and genres of the existing databases, so it is never reverted to not delete the catalog
+var migrations = []migration{
+	{
+		Version: 1,
+		Name: "create songs and genres",
+		Up: `
+			CREATE TABLE IF NOT EXISTS songs (
+			   ID INTEGER PRIMARY KEY   AUTOINCREMENT,
+			   artist           varchar(1024)      NOT NULL,
+			   song            varchar(1024)       NOT NULL,
+			   genre        integer,
+			   length         integer
+			);
+			CREATE TABLE IF NOT EXISTS genres (
+			ID INTEGER PRIMARY KEY   AUTOINCREMENT,
+			name varchar(32) NOT NULL
+			);`,
+	},
+	{
+		Version: 2,
+		Name: "create songs full-text index",
+		Module: "fts5",
+		Up: `
+			DROP TRIGGER IF EXISTS songs_search_insert;
+			DROP TRIGGER IF EXISTS songs_search_update;
+			DROP TRIGGER IF EXISTS songs_search_delete;
+			DROP TRIGGER IF EXISTS songs_search_genre_rename;
+			DROP TABLE IF EXISTS songs_search;
+
+			CREATE VIRTUAL TABLE songs_search USING fts5(artist, song, genre, tokenize = 'unicode61 remove_diacritics 1');
+
+			CREATE TRIGGER songs_search_insert AFTER INSERT ON songs BEGIN
+				INSERT INTO songs_search (rowid, artist, song, genre)
+				VALUES (NEW.ID, NEW.artist, NEW.song, IFNULL((SELECT name FROM genres WHERE ID = NEW.genre), ''));
+			END;
+
+			CREATE TRIGGER songs_search_update AFTER UPDATE ON songs BEGIN
+				DELETE FROM songs_search WHERE rowid = OLD.ID;
+				INSERT INTO songs_search (rowid, artist, song, genre)
+				VALUES (NEW.ID, NEW.artist, NEW.song, IFNULL((SELECT name FROM genres WHERE ID = NEW.genre), ''));
+			END;
+
+			CREATE TRIGGER songs_search_delete AFTER DELETE ON songs BEGIN
+				DELETE FROM songs_search WHERE rowid = OLD.ID;
+			END;
+
+			CREATE TRIGGER songs_search_genre_rename AFTER UPDATE OF name ON genres BEGIN
+				UPDATE songs_search SET genre = NEW.name WHERE rowid IN (SELECT ID FROM songs WHERE genre = NEW.ID);
+			END;
+
+			INSERT INTO songs_search (rowid, artist, song, genre)
+			SELECT S.ID, S.artist, S.song, IFNULL(G.name, '') FROM songs as S LEFT OUTER JOIN genres as G on S.genre = G.ID;`,
+		Down: `
+			DROP TRIGGER songs_search_insert;
+			DROP TRIGGER songs_search_update;
+			DROP TRIGGER songs_search_delete;
+			DROP TRIGGER songs_search_genre_rename;
+			DROP TABLE songs_search;`,
+	},
+	{
+		Version: 3,
+		Name: "create api keys",
+		Up: `
+			CREATE TABLE api_keys (
+				ID INTEGER PRIMARY KEY   AUTOINCREMENT,
+				name varchar(256) NOT NULL,
+				prefix varchar(16) NOT NULL,
+				hash varchar(64) NOT NULL UNIQUE,
+				role varchar(16) NOT NULL,
+				created_at varchar(32) NOT NULL,
+				revoked_at varchar(32)
+			);`,
+		Down: `
+			DROP TABLE api_keys;`,
+	},
+	{
+		Version: 4,
+		Name: "create daily request quotas",
+		Up: `
+			CREATE TABLE request_quotas (
+				client varchar(64) NOT NULL,
+				day varchar(10) NOT NULL,
+				requests integer NOT NULL,
+				PRIMARY KEY (client, day)
+			);`,
+		Down: `
+			DROP TABLE request_quotas;`,
+	},
+	{
+		Version: 5,
+		Name: "create catalog revision",
+		Up: `
+			CREATE TABLE catalog_revision (
+				ID INTEGER PRIMARY KEY CHECK (ID = 1),
+				revision integer NOT NULL,
+				modified_at varchar(32) NOT NULL
+			);
+			INSERT INTO catalog_revision (ID, revision, modified_at) VALUES (1, 1, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+
+			CREATE TRIGGER catalog_revision_song_insert AFTER INSERT ON songs BEGIN
+				UPDATE catalog_revision SET revision = revision + 1, modified_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+			END;
+
+			CREATE TRIGGER catalog_revision_song_update AFTER UPDATE ON songs BEGIN
+				UPDATE catalog_revision SET revision = revision + 1, modified_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+			END;
+
+			CREATE TRIGGER catalog_revision_song_delete AFTER DELETE ON songs BEGIN
+				UPDATE catalog_revision SET revision = revision + 1, modified_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+			END;
+
+			CREATE TRIGGER catalog_revision_genre_insert AFTER INSERT ON genres BEGIN
+				UPDATE catalog_revision SET revision = revision + 1, modified_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+			END;
+
+			CREATE TRIGGER catalog_revision_genre_update AFTER UPDATE ON genres BEGIN
+				UPDATE catalog_revision SET revision = revision + 1, modified_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+			END;
+
+			CREATE TRIGGER catalog_revision_genre_delete AFTER DELETE ON genres BEGIN
+				UPDATE catalog_revision SET revision = revision + 1, modified_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+			END;`,
+		Down: `
+			DROP TRIGGER catalog_revision_song_insert;
+			DROP TRIGGER catalog_revision_song_update;
+			DROP TRIGGER catalog_revision_song_delete;
+			DROP TRIGGER catalog_revision_genre_insert;
+			DROP TRIGGER catalog_revision_genre_update;
+			DROP TRIGGER catalog_revision_genre_delete;
+			DROP TABLE catalog_revision;`,
+	},
+}
+
+/* Migration Functions */
+
+//latestMigrationVersion gives the version of the schema expected by this build
+func latestMigrationVersion() int{
+	return migrations[len(migrations)-1].Version
+}
+
+//initMigrations creates the table that records the applied migrations
+func initMigrations(database *sql.DB) error{
+	_, tableError := database.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (" +
+		"version INTEGER PRIMARY KEY, name varchar(256) NOT NULL, applied_at varchar(32) NOT NULL)")
+
+	return tableError
+}
+
+//schemaVersionDB gives the version of the last migration applied in the database, 0 when none is applied
+func schemaVersionDB(ctx context.Context, database *sql.DB) (int, error){
+	var version int
+	versionError := database.QueryRowContext(ctx, "SELECT IFNULL(MAX(version), 0) FROM schema_migrations").Scan(&version)
+
+	return version, versionError
+}
+
+//appliedMigrationsDB gives the date when each applied migration was applied, by version
+func appliedMigrationsDB(database *sql.DB) (map[int]string, error){
+	if initError := initMigrations(database); initError != nil {
+		return nil, initError
+	}
+
+	rows, rowsError := executeQuery(context.Background(), database, "SELECT version, applied_at FROM schema_migrations")
+	if rowsError != nil {
+		return nil, rowsError
+	}
+	defer rows.Close()
+
+	appliedAt := map[int]string{}
+	for rows.Next() {
+		var version int
+		var date string
+		if scanError := rows.Scan(&version, &date); scanError != nil {
+			return nil, scanError
+		}
+		appliedAt[version] = date
+	}
+
+	return appliedAt, rows.Err()
+}
+
+//migrateUp applies in order the migrations that are not applied yet and gives the number of applied migrations.
+//A migration that needs a SQLite module missing in this build is skipped when the feature that uses it is turned off,
+//it stays pending until the module is there. The only module used is fts5, by the search
+func migrateUp(database *sql.DB, enableSearch bool) (int, error){
+	appliedAt, appliedError := appliedMigrationsDB(database)
+	if appliedError != nil {
+		return 0, appliedError
+	}
+
+	applied := 0
+	for _, pending := range migrations {
+		if _, isApplied := appliedAt[pending.Version]; isApplied {
+			continue
+		}
+
+		if pending.Module != "" && !sqliteModuleAvailable(database, pending.Module) {
+			if enableSearch {
+				return applied, fmt.Errorf("migration %d (%s): the SQLite of this build has no %s module, build it with the %s tag or set enable-search=false",
+					pending.Version, pending.Name, pending.Module, pending.Module)
+			}
+
+			logMessage("warn", fmt.Sprintf("Migration %d (%s) is skipped, the SQLite of this build has no %s module", pending.Version, pending.Name, pending.Module))
+			continue
+		}
+
+		migrationError := runMigration(database, pending.Up,
+			"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			pending.Version, pending.Name, time.Now().UTC().Format(time.RFC3339))
+		if migrationError != nil {
+			return applied, fmt.Errorf("migration %d (%s): %v", pending.Version, pending.Name, migrationError)
+		}
+
+		applied++
+	}
+
+	return applied, nil
+}
+
+//migrateDown reverts the given number of migrations, starting from the last applied one, and gives the number of reverted migrations.
+//It stops with an error at a migration that can not be reverted
+func migrateDown(database *sql.DB, steps int) (int, error){
+	appliedAt, appliedError := appliedMigrationsDB(database)
+	if appliedError != nil {
+		return 0, appliedError
+	}
+
+	reverted := 0
+	for index := len(migrations) - 1; index >= 0 && reverted < steps; index-- {
+		applied := migrations[index]
+		if _, isApplied := appliedAt[applied.Version]; !isApplied {
+			continue
+		}
+
+		if applied.Down == "" {
+			return reverted, fmt.Errorf("migration %d (%s) can not be reverted, it would delete the catalog", applied.Version, applied.Name)
+		}
+
+		migrationError := runMigration(database, applied.Down,
+			"DELETE FROM schema_migrations WHERE version = ?", applied.Version)
+		if migrationError != nil {
+			return reverted, fmt.Errorf("migration %d (%s): %v", applied.Version, applied.Name, migrationError)
+		}
+
+		reverted++
+	}
+
+	return reverted, nil
+}
+
+//migrationStatusDB tells which migrations are applied in the database
+func migrationStatusDB(database *sql.DB) ([]migrationStatus, error){
+	appliedAt, appliedError := appliedMigrationsDB(database)
+	if appliedError != nil {
+		return nil, appliedError
+	}
+
+	statuses := []migrationStatus{}
+	for _, known := range migrations {
+		date, applied := appliedAt[known.Version]
+		statuses = append(statuses, migrationStatus{
+			Version: known.Version,
+			Name: known.Name,
+			Applied: applied,
+			AppliedAt: date,
+		})
+	}
+
+	return statuses, nil
+}
+
+//runMigration executes the sql of a migration and records it with the given statement, in the same transaction
+func runMigration(database *sql.DB, migrationSQL string, recordStatement string, recordParams ...interface{}) error{
+	transaction, transactionError := database.Begin()
+	if transactionError != nil {
+		return transactionError
+	}
+	defer transaction.Rollback()
+
+	if _, migrationError := transaction.Exec(migrationSQL); migrationError != nil {
+		return migrationError
+	}
+
+	if _, recordError := transaction.Exec(recordStatement, recordParams...); recordError != nil {
+		return recordError
+	}
+
+	return transaction.Commit()
+}
+
+//sqliteModuleAvailable tells if the SQLite of this build has the given virtual table module, like fts5.
+//It creates a table with the module in a transaction that is rolled back
+func sqliteModuleAvailable(database *sql.DB, module string) bool{
+	transaction, transactionError := database.Begin()
+	if transactionError != nil {
+		return false
+	}
+	defer transaction.Rollback()
+
+	_, probeError := transaction.Exec("CREATE VIRTUAL TABLE temp.module_probe USING " + module + "(probe)")
+	return probeError == nil
+}
+
+//migrateCommand runs the migrate command given in the arguments: up, down [steps] or status.
+//It gives the exit status of the command
+func migrateCommand(database *sql.DB, args []string, enableSearch bool) int{
+	if len(args) == 0 {
+		fmt.Println("Usage: BeenVerified migrate up|down [steps]|status")
+		return 2
+	}
+
+	switch args[0] {
+	case "up":
+		applied, migrateError := migrateUp(database, enableSearch)
+		fmt.Printf("Applied %d migrations\n", applied)
+		if migrateError != nil {
+			fmt.Println("Something went wrong applying the migrations")
+			fmt.Println(migrateError)
+			return 1
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if _, scanError := fmt.Sscanf(args[1], "%d", &steps); scanError != nil || steps < 1 {
+				fmt.Println("Invalid number of steps: " + args[1])
+				return 2
+			}
+		}
+
+		reverted, migrateError := migrateDown(database, steps)
+		fmt.Printf("Reverted %d migrations\n", reverted)
+		if migrateError != nil {
+			fmt.Println("Something went wrong reverting the migrations")
+			fmt.Println(migrateError)
+			return 1
+		}
+
+	case "status":
+		statuses, statusError := migrationStatusDB(database)
+		if statusError != nil {
+			fmt.Println("Something went wrong reading the migrations")
+			fmt.Println(statusError)
+			return 1
+		}
+
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied at " + status.AppliedAt
+			}
+			fmt.Printf("%4d  %-40s %s\n", status.Version, status.Name, state)
+		}
+
+	default:
+		fmt.Println("Unknown migrate command: " + args[0])
+		return 2
+	}
+
+	return 0
+}
@@ -1,5 +1,13 @@
 package main
 
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"encoding/json"
+	"encoding/xml"
+)
+
 //Song 
 type Song struct{
 	ID int 
@@ -9,9 +17,59 @@ type Song struct{
 	Length int
 }
 
-//Array of Songs
+//UnmarshalJSON decodes a song whose genre is given by its name or by its ID, as a text or as a number.
+//The fields that are not given keep their values, so a song can be decoded on top of a stored one
+func (song *Song) UnmarshalJSON(data []byte) error{
+	type songFields Song
+	fields := struct{
+		*songFields
+		Genre json.RawMessage
+	}{songFields: (*songFields)(song)}
+
+	if decodeError := json.Unmarshal(data, &fields); decodeError != nil {
+		return decodeError
+	}
+
+	genre := bytes.TrimSpace(fields.Genre)
+	switch {
+	case len(genre) == 0 || bytes.Equal(genre, []byte("null")):
+	case genre[0] == '"':
+		return json.Unmarshal(genre, &song.Genre)
+	default:
+		id, idError := strconv.Atoi(string(genre))
+		if idError != nil {
+			return errors.New("the genre has to be a name or an ID")
+		}
+		song.Genre = strconv.Itoa(id)
+	}
+
+	return nil
+}
+
+//Array of Songs, and the total number of songs in all the pages
 type SongsList struct{
-	Songs []Song
+	Songs []Song `xml:"Song"`
+	Total int
+}
+
+//Song found by a search, with its relevance and the searched text highlighted
+type SearchResult struct{
+	Song
+	Score float64
+	Highlights SongHighlights
+}
+
+//Artist, song and genre of a song with the searched text highlighted
+type SongHighlights struct{
+	Artist string
+	Song string
+	Genre string
+}
+
+//Array of search results, and the total number of results in all the pages
+type SearchResultsList struct{
+	Results []SearchResult `xml:"Result"`
+	Total int
 }
 
 //Genre
@@ -23,5 +81,108 @@ type Genre struct{
 
 //Array of Genres
 type GenresList struct{
-	Genres []Genre
-}
\ No newline at end of file
+	Genres []Genre `xml:"Genre"`
+}
+
+//Error response
+type ErrorResponse struct{
+	Error ErrorDetail
+}
+
+//Error code, message and ID of the request that failed
+type ErrorDetail struct{
+	Code string
+	Message string
+	RequestID string
+}
+
+
+//Health of the server and the checks done to know it
+type HealthStatus struct{
+	Status string
+	Checks []HealthCheck
+}
+
+//Check done to know the health of the server
+type HealthCheck struct{
+	Name string
+	Status string
+	Message string
+}
+
+//Build information of the server
+type VersionInfo struct{
+	Version string
+	Commit string
+	BuildDate string
+	GoVersion string
+	SchemaVersion int
+}
+
+
+/* Version 2 */
+
+//Document of every successful response of the version 2 of the API
+type DocumentV2 struct{
+	XMLName xml.Name `json:"-" xml:"document"`
+	Data interface{} `json:"data" xml:"data"`
+	Meta MetaV2 `json:"meta" xml:"meta"`
+	Links LinksV2 `json:"links" xml:"links"`
+}
+
+//Document of every failed response of the version 2 of the API
+type ErrorDocumentV2 struct{
+	XMLName xml.Name `json:"-" xml:"document"`
+	Error ErrorDetailV2 `json:"error" xml:"error"`
+	Meta MetaV2 `json:"meta" xml:"meta"`
+}
+
+//Information about a response of the version 2, the total is only given for the lists
+type MetaV2 struct{
+	APIVersion int `json:"api_version" xml:"api_version"`
+	RequestID string `json:"request_id" xml:"request_id"`
+	Total *int `json:"total,omitempty" xml:"total,omitempty"`
+}
+
+//Links of a response of the version 2, the next and previous pages are only given for the lists that have them
+type LinksV2 struct{
+	Self string `json:"self" xml:"self"`
+	Next string `json:"next,omitempty" xml:"next,omitempty"`
+	Prev string `json:"prev,omitempty" xml:"prev,omitempty"`
+}
+
+//Error code and message of a failed response of the version 2
+type ErrorDetailV2 struct{
+	Code string `json:"code" xml:"code"`
+	Message string `json:"message" xml:"message"`
+}
+
+//Song of the version 2
+type SongV2 struct{
+	ID int `json:"id" xml:"id"`
+	Artist string `json:"artist" xml:"artist"`
+	Song string `json:"song" xml:"song"`
+	Genre string `json:"genre" xml:"genre"`
+	Length int `json:"length" xml:"length"`
+}
+
+//Search result of the version 2
+type SearchResultV2 struct{
+	SongV2
+	Score float64 `json:"score" xml:"score"`
+	Highlights SongHighlightsV2 `json:"highlights" xml:"highlights"`
+}
+
+//Highlighted fields of a search result of the version 2
+type SongHighlightsV2 struct{
+	Artist string `json:"artist" xml:"artist"`
+	Song string `json:"song" xml:"song"`
+	Genre string `json:"genre" xml:"genre"`
+}
+
+//Genre of the version 2
+type GenreV2 struct{
+	Name string `json:"name" xml:"name"`
+	NumberOfSongs int `json:"number_of_songs" xml:"number_of_songs"`
+	TotalLength int `json:"total_length" xml:"total_length"`
+}
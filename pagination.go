@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"encoding/base64"
+	"encoding/json"
+
+	"net/http"
+	"net/url"
+)
+
+/* Constants */
+
+//Number of songs in a page when the limit is not given, and the greatest limit accepted
+const defaultPageLimit = 100
+const maxPageLimit = 1000
+
+//Columns of the song listings that can be used to sort them, by the name of the sort parameter.
+//Text columns are sorted without case
+var songSortColumns = map[string]string{
+	"id": "ID",
+	"artist": "artist COLLATE NOCASE",
+	"song": "song COLLATE NOCASE",
+	"genre": "name COLLATE NOCASE",
+	"length": "IFNULL(length, 0)",
+}
+
+/* Types */
+
+//listOptions holds the paging and sorting options of a song listing
+type listOptions struct{
+	Limit int
+	Offset int
+	Sort string
+	Descending bool
+
+	//Cursor is nil when the listing is paged by offset
+	Cursor *songCursor
+	CursorPaging bool
+}
+
+//songCursor points to a song in a sorted listing. The page starts right after the song,
+//or ends right before it when Before is true
+type songCursor struct{
+	Sort string `json:"s"`
+	Descending bool `json:"d,omitempty"`
+	Value interface{} `json:"v"`
+	ID int `json:"i"`
+	Before bool `json:"b,omitempty"`
+}
+
+//pageBounds counts the songs of a page and keeps the first and the last ones, which are enough to link to the other pages
+type pageBounds struct{
+	Count int
+	First Song
+	Last Song
+}
+
+//add counts a song of the page, in the order of the page
+func (bounds *pageBounds) add(song Song){
+	if bounds.Count == 0 {
+		bounds.First = song
+	}
+	bounds.Last = song
+	bounds.Count++
+}
+
+/* Paging Functions */
+
+//parseListOptions gets the paging and sorting options given in the query of the request:
+//limit, offset, cursor, sort and order
+func parseListOptions(r *http.Request) (listOptions, error){
+	query := r.URL.Query()
+
+	options := listOptions{
+		Sort: "id",
+	}
+
+	var limitsError error
+	options.Limit, options.Offset, limitsError = parsePageLimits(query)
+	if limitsError != nil {
+		return options, limitsError
+	}
+
+	if sort := strings.ToLower(query.Get("sort")); sort != "" {
+		if _, isSortColumn := songSortColumns[sort]; !isSortColumn {
+			return options, newBadRequestError("Invalid sort: " + sort + ". Use artist, song, genre, length or id")
+		}
+		options.Sort = sort
+	}
+
+	switch order := strings.ToLower(query.Get("order")); order {
+	case "", "asc":
+	case "desc":
+		options.Descending = true
+	default:
+		return options, newBadRequestError("Invalid order: " + order + ". Use asc or desc")
+	}
+
+	//The cursor parameter turns on the cursor paging, an empty cursor gives the first page
+	if _, hasCursor := query["cursor"]; hasCursor {
+		options.CursorPaging = true
+
+		if cursor := query.Get("cursor"); cursor != "" {
+			if options.Offset > 0 {
+				return options, newBadRequestError("The cursor and the offset can not be used together")
+			}
+
+			songCursor, cursorError := decodeCursor(cursor)
+			if cursorError != nil {
+				return options, newBadRequestError("Invalid cursor: " + cursor)
+			}
+
+			//The cursor keeps the sorting of the listing where it was created
+			options.Cursor = songCursor
+			options.Sort = songCursor.Sort
+			options.Descending = songCursor.Descending
+		}
+	}
+
+	return options, nil
+}
+
+//parsePageLimits gets the limit and offset given in the query of a request
+func parsePageLimits(query url.Values) (int, int, error){
+	limit, offset := defaultPageLimit, 0
+
+	if value := query.Get("limit"); value != "" {
+		number, numberError := strconv.Atoi(value)
+		if numberError != nil || number < 1 || number > maxPageLimit {
+			return 0, 0, newBadRequestError(fmt.Sprintf("Invalid limit: %s. It has to be a number between 1 and %d", value, maxPageLimit))
+		}
+		limit = number
+	}
+
+	if value := query.Get("offset"); value != "" {
+		number, numberError := strconv.Atoi(value)
+		if numberError != nil || number < 0 {
+			return 0, 0, newBadRequestError("Invalid offset: " + value + ". It has to be a positive number")
+		}
+		offset = number
+	}
+
+	return limit, offset, nil
+}
+
+//encodeCursor encodes the cursor that points to the given song in the sorted listing
+func encodeCursor(options listOptions, song Song, before bool) string{
+	cursor := songCursor{
+		Sort: options.Sort,
+		Descending: options.Descending,
+		ID: song.ID,
+		Before: before,
+	}
+
+	switch options.Sort {
+	case "artist":
+		cursor.Value = song.Artist
+	case "song":
+		cursor.Value = song.Song
+	case "genre":
+		cursor.Value = song.Genre
+	case "length":
+		cursor.Value = song.Length
+	default:
+		cursor.Value = song.ID
+	}
+
+	jsonCursor, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(jsonCursor)
+}
+
+//decodeCursor decodes a cursor created by encodeCursor
+func decodeCursor(value string) (*songCursor, error){
+	jsonCursor, decodeError := base64.RawURLEncoding.DecodeString(value)
+	if decodeError != nil {
+		return nil, decodeError
+	}
+
+	cursor := &songCursor{}
+	if jsonError := json.Unmarshal(jsonCursor, cursor); jsonError != nil {
+		return nil, jsonError
+	}
+
+	if _, isSortColumn := songSortColumns[cursor.Sort]; !isSortColumn {
+		return nil, fmt.Errorf("unknown sort %q", cursor.Sort)
+	}
+
+	return cursor, nil
+}
+
+//pageLinks gives the URLs of the next and previous pages by their relation, when there are such pages
+func pageLinks(r *http.Request, options listOptions, total int, bounds pageBounds) map[string]string{
+	links := map[string]string{}
+
+	if options.CursorPaging {
+
+		//A full page may be followed by more songs, and a page reached with a cursor may have songs before it
+		hasNext := bounds.Count == options.Limit
+		hasPrevious := options.Cursor != nil
+		if options.Cursor != nil && options.Cursor.Before {
+			hasNext, hasPrevious = true, bounds.Count == options.Limit
+		}
+
+		if hasNext && bounds.Count > 0 {
+			links["next"] = pageLink(r, map[string]string{"cursor": encodeCursor(options, bounds.Last, false)})
+		}
+		if hasPrevious && bounds.Count > 0 {
+			links["prev"] = pageLink(r, map[string]string{"cursor": encodeCursor(options, bounds.First, true)})
+		}
+	}else{
+		if options.Offset + options.Limit < total {
+			links["next"] = pageLink(r, map[string]string{"offset": strconv.Itoa(options.Offset + options.Limit)})
+		}
+		if options.Offset > 0 {
+			previousOffset := options.Offset - options.Limit
+			if previousOffset < 0 {
+				previousOffset = 0
+			}
+			links["prev"] = pageLink(r, map[string]string{"offset": strconv.Itoa(previousOffset)})
+		}
+	}
+
+	return links
+}
+
+//writePageHeaders writes the total number of songs and the RFC 5988 links to the next and previous pages
+func writePageHeaders(w http.ResponseWriter, total int, links map[string]string){
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	for _, relation := range []string{"next", "prev"} {
+		if link, hasLink := links[relation]; hasLink {
+			w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"%s\"", link, relation))
+		}
+	}
+}
+
+//pageLink gives the URL of the request with some of its query parameters changed
+func pageLink(r *http.Request, params map[string]string) string{
+	query := r.URL.Query()
+	for name, value := range params {
+		query.Set(name, value)
+	}
+
+	link := url.URL{
+		Path: r.URL.Path,
+		RawQuery: query.Encode(),
+	}
+
+	return link.String()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"testing"
+
+	"net/http/httptest"
+	"net/url"
+)
+
+/* Cursor Tests */
+
+func TestCursorRoundTrip(t *testing.T){
+	song := Song{ID: 7, Artist: "The Beatles", Song: "Help!", Genre: "Rock", Length: 140}
+
+	tests := []struct{
+		sort string
+		descending bool
+		before bool
+		value interface{}
+	}{
+		{"id", false, false, float64(7)},
+		{"artist", false, false, "The Beatles"},
+		{"song", true, false, "Help!"},
+		{"genre", false, true, "Rock"},
+		{"length", true, true, float64(140)},
+	}
+
+	for _, test := range tests {
+		options := listOptions{Sort: test.sort, Descending: test.descending}
+		cursor, cursorError := decodeCursor(encodeCursor(options, song, test.before))
+		if cursorError != nil {
+			t.Errorf("the cursor sorted by %s can not be decoded: %v", test.sort, cursorError)
+			continue
+		}
+
+		if cursor.Sort != test.sort || cursor.Descending != test.descending || cursor.Before != test.before || cursor.ID != song.ID || cursor.Value != test.value {
+			t.Errorf("the cursor sorted by %s was decoded as %+v", test.sort, *cursor)
+		}
+	}
+}
+
+func TestDecodeInvalidCursor(t *testing.T){
+	tests := []string{
+		"not base64!",
+		"bm90IGpzb24",
+		"eyJzIjoicmF0aW5nIiwidiI6MSwiaSI6MX0",
+	}
+
+	for _, value := range tests {
+		if _, cursorError := decodeCursor(value); cursorError == nil {
+			t.Errorf("the invalid cursor %q was decoded", value)
+		}
+	}
+}
+
+/* Link Tests */
+
+func TestPageLinksByOffset(t *testing.T){
+	tests := []struct{
+		offset int
+		limit int
+		total int
+		next string
+		prev string
+	}{
+		{0, 10, 25, "10", ""},
+		{10, 10, 25, "20", "0"},
+		{20, 10, 25, "", "10"},
+		{5, 10, 25, "15", "0"},
+		{0, 10, 10, "", ""},
+		{0, 10, 0, "", ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/songs?limit=10&sort=artist", nil)
+		links := pageLinks(r, listOptions{Limit: test.limit, Offset: test.offset}, test.total, pageBounds{})
+
+		for relation, offset := range map[string]string{"next": test.next, "prev": test.prev} {
+			link, hasLink := links[relation]
+			if offset == "" {
+				if hasLink {
+					t.Errorf("offset %d of %d has the %s link %s", test.offset, test.total, relation, link)
+				}
+				continue
+			}
+
+			query := linkQuery(t, link)
+			if query.Get("offset") != offset || query.Get("sort") != "artist" || query.Get("limit") != "10" {
+				t.Errorf("offset %d of %d has the %s link %s, offset %s expected", test.offset, test.total, relation, link, offset)
+			}
+		}
+	}
+}
+
+func TestPageLinksByCursor(t *testing.T){
+	first, last := Song{ID: 1}, Song{ID: 2}
+
+	tests := []struct{
+		name string
+		cursor *songCursor
+		count int
+		hasNext bool
+		hasPrev bool
+	}{
+		{"first full page", nil, 2, true, false},
+		{"first short page", nil, 1, false, false},
+		{"empty page", &songCursor{Sort: "id"}, 0, false, false},
+		{"full page after a song", &songCursor{Sort: "id"}, 2, true, true},
+		{"last page after a song", &songCursor{Sort: "id"}, 1, false, true},
+		{"full page before a song", &songCursor{Sort: "id", Before: true}, 2, true, true},
+		{"first page before a song", &songCursor{Sort: "id", Before: true}, 1, true, false},
+	}
+
+	for _, test := range tests {
+		bounds := pageBounds{}
+		for _, song := range []Song{first, last}[:test.count] {
+			bounds.add(song)
+		}
+
+		r := httptest.NewRequest("GET", "/songs?cursor=", nil)
+		links := pageLinks(r, listOptions{Limit: 2, Sort: "id", Cursor: test.cursor, CursorPaging: true}, 0, bounds)
+
+		next, hasNext := links["next"]
+		prev, hasPrev := links["prev"]
+		if hasNext != test.hasNext || hasPrev != test.hasPrev {
+			t.Errorf("the %s has the links %v", test.name, links)
+			continue
+		}
+
+		if hasNext {
+			if cursor, _ := decodeCursor(linkQuery(t, next).Get("cursor")); cursor == nil || cursor.ID != bounds.Last.ID || cursor.Before {
+				t.Errorf("the next link of the %s does not start after its last song: %s", test.name, next)
+			}
+		}
+		if hasPrev {
+			if cursor, _ := decodeCursor(linkQuery(t, prev).Get("cursor")); cursor == nil || cursor.ID != bounds.First.ID || !cursor.Before {
+				t.Errorf("the prev link of the %s does not end before its first song: %s", test.name, prev)
+			}
+		}
+	}
+}
+
+//linkQuery gives the query parameters of a page link
+func linkQuery(t *testing.T, link string) url.Values{
+	parsed, parseError := url.Parse(link)
+	if parseError != nil {
+		t.Fatalf("invalid link %s: %v", link, parseError)
+	}
+	return parsed.Query()
+}
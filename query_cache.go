@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"context"
+	"container/list"
+
+	"database/sql"
+)
+
+/* Types */
+
+//resultRows are the rows of a query, read from the database or from the query cache.
+//*sql.Rows is one of them
+type resultRows interface{
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close() error
+}
+
+//queryCache keeps the results of the last used catalog queries, keyed by their normalized sql statement and parameters.
+//Each result keeps the revision of the catalog it was read in, and it is only used while the catalog has that revision,
+//so any change of the songs or the genres invalidates it
+type queryCache struct{
+	mutex sync.Mutex
+	size int
+	entries map[string]*list.Element
+	recent *list.List
+}
+
+//cachedResult is the result of a query in the cache
+type cachedResult struct{
+	Key string
+	Revision int
+	Rows [][]interface{}
+}
+
+//cachedRows gives the rows of a cached result
+type cachedRows struct{
+	rows [][]interface{}
+	index int
+}
+
+//catalogRevisionKey is the key in the context of a request of the catalog revision read when the request started
+type catalogRevisionKey struct{}
+
+//recordingRows reads the rows of a query from the database and stores them in the cache when all of them are read
+type recordingRows struct{
+	*sql.Rows
+	cache *queryCache
+	key string
+	revision int
+	rows [][]interface{}
+	failed bool
+}
+
+/* Cache */
+
+//catalogQueries is the query cache of the server, nil when the cache is turned off
+var catalogQueries *queryCache
+
+/* Metrics */
+
+var queryCacheRequests = appMetrics.newFamily("bv_query_cache_requests_total", "Number of catalog queries looked up in the query cache by result, hit or miss.",
+	"counter", nil, "result")
+var queryCacheEvictions = appMetrics.newFamily("bv_query_cache_evictions_total", "Number of results removed from the query cache to make room for new ones.",
+	"counter", nil)
+
+/* Query Cache Functions */
+
+//newQueryCache creates a query cache that keeps up to size results, the least recently used one is removed to make room
+func newQueryCache(size int) *queryCache{
+	return &queryCache{
+		size: size,
+		entries: map[string]*list.Element{},
+		recent: list.New(),
+	}
+}
+
+//get gives the rows cached for the key in the given revision of the catalog.
+//A result of an older revision is removed, it can not be used anymore
+func (cache *queryCache) get(key string, revision int) ([][]interface{}, bool){
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, exists := cache.entries[key]
+	if !exists {
+		return nil, false
+	}
+
+	result := element.Value.(*cachedResult)
+	if result.Revision != revision {
+		cache.recent.Remove(element)
+		delete(cache.entries, key)
+		return nil, false
+	}
+
+	cache.recent.MoveToFront(element)
+	return result.Rows, true
+}
+
+//put stores the rows of the key read in the given revision of the catalog
+func (cache *queryCache) put(key string, revision int, rows [][]interface{}){
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, exists := cache.entries[key]; exists {
+		element.Value = &cachedResult{Key: key, Revision: revision, Rows: rows}
+		cache.recent.MoveToFront(element)
+		return
+	}
+
+	cache.entries[key] = cache.recent.PushFront(&cachedResult{Key: key, Revision: revision, Rows: rows})
+
+	for cache.recent.Len() > cache.size {
+		oldest := cache.recent.Back()
+		cache.recent.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*cachedResult).Key)
+		appMetrics.add(queryCacheEvictions, 1)
+	}
+}
+
+//len gives the number of results in the cache
+func (cache *queryCache) len() int{
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return cache.recent.Len()
+}
+
+/* Query Functions */
+
+//executeCachedQuery executes a query over the catalog through the query cache. The rows are given from the cache when it has them
+//for the current revision of the catalog, otherwise they are read from the database and stored once the caller has read all of them
+func executeCachedQuery(ctx context.Context, database *sql.DB, sqlStatement string, params ...interface{}) (resultRows, error){
+	if catalogQueries == nil {
+		rows, rowsError := executeQuery(ctx, database, sqlStatement, params...)
+		if rowsError != nil {
+			return nil, rowsError
+		}
+		return rows, nil
+	}
+
+	//The revision is read before the query, so a change in between stores the rows with an older revision that is never used.
+	//The conditional reads have already read it for their ETag, and all the queries of the request use that one
+	revision, hasRevision := ctx.Value(catalogRevisionKey{}).(int)
+	if !hasRevision {
+		var revisionError error
+		revision, _, revisionError = catalogRevisionDB(ctx, database)
+		if revisionError != nil {
+			return nil, revisionError
+		}
+	}
+
+	key := queryCacheKey(sqlStatement, params)
+	if rows, cached := catalogQueries.get(key, revision); cached {
+		appMetrics.add(queryCacheRequests, 1, "hit")
+		traceEvent(ctx, "query cache hit for %s, %d rows", describeStatement(sqlStatement), len(rows))
+		return &cachedRows{rows: rows, index: -1}, nil
+	}
+	appMetrics.add(queryCacheRequests, 1, "miss")
+
+	rows, rowsError := executeQuery(ctx, database, sqlStatement, params...)
+	if rowsError != nil {
+		return nil, rowsError
+	}
+
+	return &recordingRows{Rows: rows, cache: catalogQueries, key: key, revision: revision}, nil
+}
+
+//withCatalogRevision gives a copy of the context that keeps the revision of the catalog,
+//so the cached queries of a request do not read it again
+func withCatalogRevision(ctx context.Context, revision int) context.Context{
+	return context.WithValue(ctx, catalogRevisionKey{}, revision)
+}
+
+//queryCachedTotal executes a query over the catalog that gives one number, like a count, through the query cache
+func queryCachedTotal(ctx context.Context, database *sql.DB, sqlStatement string, params ...interface{}) (int, error){
+	rows, rowsError := executeCachedQuery(ctx, database, sqlStatement, params...)
+	if rowsError != nil {
+		return 0, rowsError
+	}
+	defer rows.Close()
+
+	var total int
+	if !rows.Next() {
+		if rowsError := rows.Err(); rowsError != nil {
+			return 0, rowsError
+		}
+		return 0, sql.ErrNoRows
+	}
+	if totalError := rows.Scan(&total); totalError != nil {
+		return 0, totalError
+	}
+
+	//Read to the end so the number is stored in the cache
+	rows.Next()
+
+	return total, rows.Err()
+}
+
+//queryCacheKey gives the key of a query in the cache: its sql statement with the spaces normalized, and its typed parameters
+func queryCacheKey(sqlStatement string, params []interface{}) string{
+	key := []string{strings.Join(strings.Fields(sqlStatement), " ")}
+	for _, param := range params {
+		key = append(key, fmt.Sprintf("%T:%v", param, param))
+	}
+
+	return strings.Join(key, "\x1f")
+}
+
+/* Rows Functions */
+
+//Next moves to the next cached row
+func (rows *cachedRows) Next() bool{
+	if rows.index >= len(rows.rows) {
+		return false
+	}
+	rows.index++
+	return rows.index < len(rows.rows)
+}
+
+//Scan copies the values of the current cached row into dest, which has the same types that the row was read with
+func (rows *cachedRows) Scan(dest ...interface{}) error{
+	if rows.index < 0 || rows.index >= len(rows.rows) {
+		return fmt.Errorf("sql: Scan called without calling Next")
+	}
+
+	row := rows.rows[rows.index]
+	if len(dest) != len(row) {
+		return fmt.Errorf("sql: expected %d destination arguments in Scan, not %d", len(row), len(dest))
+	}
+
+	for index, value := range row {
+		target := reflect.ValueOf(dest[index])
+		if target.Kind() != reflect.Ptr || target.IsNil() || target.Elem().Type() != reflect.TypeOf(value) {
+			return fmt.Errorf("sql: can not scan the cached %T into the column %d of type %T", value, index, dest[index])
+		}
+		target.Elem().Set(reflect.ValueOf(value))
+	}
+
+	return nil
+}
+
+//Err gives nil, the cached rows were read without errors
+func (rows *cachedRows) Err() error{
+	return nil
+}
+
+//Close does nothing, the cached rows do not hold a connection
+func (rows *cachedRows) Close() error{
+	return nil
+}
+
+//Next moves to the next row of the database, and stores the rows in the cache after the last one
+//when every row was read without errors
+func (rows *recordingRows) Next() bool{
+	if rows.Rows.Next() {
+		rows.rows = append(rows.rows, nil)
+		return true
+	}
+
+	if !rows.failed && rows.Rows.Err() == nil {
+		for _, row := range rows.rows {
+			if row == nil {
+				return false
+			}
+		}
+		rows.cache.put(rows.key, rows.revision, rows.rows)
+	}
+	return false
+}
+
+//Scan reads the current row of the database into dest and keeps a copy of the values
+func (rows *recordingRows) Scan(dest ...interface{}) error{
+	if scanError := rows.Rows.Scan(dest...); scanError != nil {
+		rows.failed = true
+		return scanError
+	}
+
+	if len(rows.rows) == 0 {
+		return nil
+	}
+
+	row := make([]interface{}, len(dest))
+	for index, target := range dest {
+		row[index] = reflect.ValueOf(target).Elem().Interface()
+	}
+	rows.rows[len(rows.rows) - 1] = row
+
+	return nil
+}
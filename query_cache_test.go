@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+)
+
+/* Query Cache Tests */
+
+func TestQueryCacheEviction(t *testing.T){
+	tests := []struct{
+		name string
+		steps func(cache *queryCache)
+		kept []string
+		evicted []string
+	}{
+		{
+			name: "the least recently stored result is evicted",
+			steps: func(cache *queryCache){
+				cache.put("a", 1, nil)
+				cache.put("b", 1, nil)
+				cache.put("c", 1, nil)
+			},
+			kept: []string{"b", "c"},
+			evicted: []string{"a"},
+		},
+		{
+			name: "a result that is read is kept",
+			steps: func(cache *queryCache){
+				cache.put("a", 1, nil)
+				cache.put("b", 1, nil)
+				cache.get("a", 1)
+				cache.put("c", 1, nil)
+			},
+			kept: []string{"a", "c"},
+			evicted: []string{"b"},
+		},
+		{
+			name: "a result that is stored again is kept",
+			steps: func(cache *queryCache){
+				cache.put("a", 1, nil)
+				cache.put("b", 1, nil)
+				cache.put("a", 1, nil)
+				cache.put("c", 1, nil)
+			},
+			kept: []string{"a", "c"},
+			evicted: []string{"b"},
+		},
+		{
+			name: "a result of an older revision is removed when it is read",
+			steps: func(cache *queryCache){
+				cache.put("a", 1, nil)
+				cache.put("b", 2, nil)
+				cache.get("a", 2)
+			},
+			kept: []string{"b"},
+			evicted: []string{"a"},
+		},
+	}
+
+	for _, test := range tests {
+		cache := newQueryCache(2)
+		test.steps(cache)
+
+		if cache.len() != len(test.kept) {
+			t.Errorf("%s: the cache has %d results, %d expected", test.name, cache.len(), len(test.kept))
+		}
+		for _, key := range test.kept {
+			if _, exists := cache.entries[key]; !exists {
+				t.Errorf("%s: the result %s was evicted", test.name, key)
+			}
+		}
+		for _, key := range test.evicted {
+			if _, exists := cache.entries[key]; exists {
+				t.Errorf("%s: the result %s was kept", test.name, key)
+			}
+		}
+	}
+}
+
+func TestQueryCacheRevision(t *testing.T){
+	cache := newQueryCache(2)
+	cache.put("songs", 3, [][]interface{}{{1, "Help!"}})
+
+	if rows, cached := cache.get("songs", 3); !cached || len(rows) != 1 {
+		t.Errorf("the result of the revision 3 was not given in the revision 3")
+	}
+	if _, cached := cache.get("songs", 4); cached {
+		t.Errorf("the result of the revision 3 was given in the revision 4")
+	}
+	if _, cached := cache.get("songs", 3); cached {
+		t.Errorf("the result of an older revision was kept after it was read")
+	}
+}
+
+func TestCachedRowsScan(t *testing.T){
+	rows := &cachedRows{rows: [][]interface{}{{1, "Help!"}, {2, "Yesterday"}}, index: -1}
+
+	var id int
+	var song string
+	if scanError := rows.Scan(&id, &song); scanError == nil {
+		t.Errorf("a row was scanned before calling Next")
+	}
+
+	songs := []string{}
+	for rows.Next() {
+		if scanError := rows.Scan(&id, &song); scanError != nil {
+			t.Fatalf("the cached row can not be scanned: %v", scanError)
+		}
+		songs = append(songs, song)
+	}
+	if len(songs) != 2 || songs[0] != "Help!" || songs[1] != "Yesterday" || id != 2 {
+		t.Errorf("the cached rows were read as %v, the last ID %d", songs, id)
+	}
+	if rows.Next() {
+		t.Errorf("Next gave a row after the last one")
+	}
+
+	rows = &cachedRows{rows: [][]interface{}{{1, "Help!"}}, index: -1}
+	rows.Next()
+	if scanError := rows.Scan(&song, &id); scanError == nil {
+		t.Errorf("the cached values were scanned into columns of other types")
+	}
+	if scanError := rows.Scan(&id); scanError == nil {
+		t.Errorf("the cached row was scanned into fewer columns")
+	}
+}
+
+func TestQueryCacheKey(t *testing.T){
+	tests := []struct{
+		first string
+		firstParams []interface{}
+		second string
+		secondParams []interface{}
+		same bool
+	}{
+		{"SELECT * FROM songs", nil, "SELECT  *\n\tFROM songs ", nil, true},
+		{"SELECT * FROM songs WHERE ID = ?", []interface{}{1}, "SELECT * FROM songs WHERE ID = ?", []interface{}{1}, true},
+		{"SELECT * FROM songs WHERE ID = ?", []interface{}{1}, "SELECT * FROM songs WHERE ID = ?", []interface{}{2}, false},
+		{"SELECT * FROM songs WHERE ID = ?", []interface{}{1}, "SELECT * FROM songs WHERE ID = ?", []interface{}{"1"}, false},
+		{"SELECT * FROM songs", nil, "SELECT * FROM genres", nil, false},
+	}
+
+	for _, test := range tests {
+		first, second := queryCacheKey(test.first, test.firstParams), queryCacheKey(test.second, test.secondParams)
+		if (first == second) != test.same {
+			t.Errorf("the keys %q and %q are the same: %v, %v expected", first, second, first == second, test.same)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"net/http"
+	"database/sql"
+)
+
+/* Constants */
+
+//Classes of routes that have their own rate limit
+const (
+	searchRateClass = "search"
+	listRateClass = "list"
+)
+
+//Routes that filter or search the songs, every other route is in the list class
+var searchRateRoutes = map[string]bool{
+	"/search": true,
+	"/songs/artist/:artist": true,
+	"/songs/song/:song": true,
+	"/songs/genre/:genre": true,
+	"/songs/length/:minLength/:maxLength": true,
+}
+
+//How often the buckets that are full again are forgotten
+const rateBucketSweepInterval = time.Minute
+
+/* Types */
+
+//rateLimitRule allows a burst of Requests that is refilled evenly during Period
+type rateLimitRule struct{
+	Requests int
+	Period time.Duration
+}
+
+//String gives the rule in the format that is read by parseRateLimitRule
+func (rule rateLimitRule) String() string{
+	return strconv.Itoa(rule.Requests) + "/" + rule.Period.String()
+}
+
+//tokenBucket holds the requests that a client can still make in a class of routes
+type tokenBucket struct{
+	Tokens float64
+	Updated time.Time
+}
+
+//rateLimiter limits the requests of each client, identified by its API key or its IP address,
+//with a token bucket for each class of routes and optionally with a daily quota stored in the database
+type rateLimiter struct{
+	database *sql.DB
+	rules map[string]rateLimitRule
+	dailyQuota int
+
+	mutex sync.Mutex
+	buckets map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+/* Metrics */
+
+var rateLimitedTotal = appMetrics.newFamily("bv_rate_limited_requests_total", "Number of requests refused by the rate limit or the daily quota.",
+	"counter", nil, "class", "reason")
+
+/* Rate Limiter Functions */
+
+//newRateLimiter creates a rate limiter with the rules of the search and list routes.
+//When dailyQuota is greater than 0 each client can only make that number of requests per UTC day
+func newRateLimiter(database *sql.DB, searchRule rateLimitRule, listRule rateLimitRule, dailyQuota int) *rateLimiter{
+	return &rateLimiter{
+		database: database,
+		rules: map[string]rateLimitRule{
+			searchRateClass: searchRule,
+			listRateClass: listRule,
+		},
+		dailyQuota: dailyQuota,
+		buckets: map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+//middleware answers with a 429 error the requests of the clients that went over the rate limit of the route or their daily quota.
+//Every limited response has the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers
+func (limiter *rateLimiter) middleware(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		routePattern := matchedPattern(r)
+		if publicRoutes[routePattern] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		class := listRateClass
+		if searchRateRoutes[unversionedPattern(routePattern)] {
+			class = searchRateClass
+		}
+		rule := limiter.rules[class]
+		client := rateLimitClient(r)
+
+		allowed, remaining, retryAfter, reset := limiter.take(class + " " + client, rule, time.Now())
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rule.Requests))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(secondsUntil(reset)))
+
+		if !allowed {
+			appMetrics.add(rateLimitedTotal, 1, class, "rate_limit")
+			w.Header().Set("Retry-After", strconv.Itoa(secondsUntil(retryAfter)))
+			writeError(w, r, newTooManyRequestsError("Too many " + class + " requests, the limit is " + rule.String()))
+			return
+		}
+
+		if limiter.dailyQuota > 0 {
+			requests, quotaError := countDailyRequestDB(r.Context(), limiter.database, client, time.Now().UTC().Format("2006-01-02"))
+			if quotaError != nil {
+				writeError(w, r, quotaError)
+				return
+			}
+
+			w.Header().Set("X-Quota-Limit", strconv.Itoa(limiter.dailyQuota))
+			w.Header().Set("X-Quota-Remaining", strconv.Itoa(maxInt(limiter.dailyQuota - requests, 0)))
+
+			if requests > limiter.dailyQuota {
+				appMetrics.add(rateLimitedTotal, 1, class, "daily_quota")
+				w.Header().Set("Retry-After", strconv.Itoa(secondsUntil(nextUTCDay(time.Now()))))
+				writeError(w, r, newTooManyRequestsError("The daily quota of " + strconv.Itoa(limiter.dailyQuota) + " requests is used up"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+//guardAuthentication is installed before the authentication, and charges every request refused with a 401 error to the bucket
+//of the list routes of its IP address, so guessing API keys is limited like the requests without a key. A client whose bucket is empty
+//gets a 429 error before its key is checked. The requests with a valid key are counted by the middleware, in the bucket of their key
+func (limiter *rateLimiter) guardAuthentication(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		if publicRoutes[matchedPattern(r)] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rule := limiter.rules[listRateClass]
+		key := listRateClass + " " + rateLimitClient(r)
+
+		if allowed, retryAfter := limiter.peek(key, rule, time.Now()); !allowed {
+			appMetrics.add(rateLimitedTotal, 1, listRateClass, "invalid_api_key")
+			w.Header().Set("Retry-After", strconv.Itoa(secondsUntil(retryAfter)))
+			writeError(w, r, newTooManyRequestsError("Too many requests with an invalid API key, the limit is " + rule.String()))
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		if recorder.Status == http.StatusUnauthorized {
+			limiter.take(key, rule, time.Now())
+		}
+	})
+}
+
+//take takes a token from the bucket with the given key, refilled with the rule up to the given time.
+//It tells if the request is allowed, the tokens left, when the next token is available and when the bucket is full again
+func (limiter *rateLimiter) take(key string, rule rateLimitRule, now time.Time) (bool, int, time.Time, time.Time){
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	bucket := limiter.refill(key, rule, now)
+	burst := float64(rule.Requests)
+	tokensPerSecond := burst / rule.Period.Seconds()
+
+	allowed := bucket.Tokens >= 1
+	if allowed {
+		bucket.Tokens--
+	}
+
+	retryAfter := now.Add(secondsDuration((1 - bucket.Tokens) / tokensPerSecond))
+	reset := now.Add(secondsDuration((burst - bucket.Tokens) / tokensPerSecond))
+
+	return allowed, int(bucket.Tokens), retryAfter, reset
+}
+
+//peek tells if the bucket with the given key has a token at the given time without taking it, and when the next token is available
+func (limiter *rateLimiter) peek(key string, rule rateLimitRule, now time.Time) (bool, time.Time){
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	bucket := limiter.refill(key, rule, now)
+	tokensPerSecond := float64(rule.Requests) / rule.Period.Seconds()
+
+	return bucket.Tokens >= 1, now.Add(secondsDuration((1 - bucket.Tokens) / tokensPerSecond))
+}
+
+//refill gives the bucket with the given key with the tokens earned up to the given time, a new bucket is full.
+//The mutex of the limiter has to be locked
+func (limiter *rateLimiter) refill(key string, rule rateLimitRule, now time.Time) *tokenBucket{
+	limiter.sweep(now)
+
+	burst := float64(rule.Requests)
+	tokensPerSecond := burst / rule.Period.Seconds()
+
+	bucket, exists := limiter.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{Tokens: burst, Updated: now}
+		limiter.buckets[key] = bucket
+	}
+
+	//Refill the tokens earned since the last request
+	bucket.Tokens = math.Min(burst, bucket.Tokens + now.Sub(bucket.Updated).Seconds() * tokensPerSecond)
+	bucket.Updated = now
+
+	return bucket
+}
+
+//sweep forgets the buckets that are full again, so the clients that stopped making requests do not use memory
+func (limiter *rateLimiter) sweep(now time.Time){
+	if now.Sub(limiter.lastSweep) < rateBucketSweepInterval {
+		return
+	}
+	limiter.lastSweep = now
+
+	for key, bucket := range limiter.buckets {
+		rule := limiter.rules[strings.SplitN(key, " ", 2)[0]]
+		if now.Sub(bucket.Updated) >= rule.Period {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+//rateLimitClient identifies the client of the request by its API key, or by its IP address when it has no key
+func rateLimitClient(r *http.Request) string{
+	if key, hasKey := r.Context().Value(apiKeyContextKey{}).(apiKey); hasKey {
+		return "key:" + strconv.Itoa(key.ID)
+	}
+
+	host, _, splitError := net.SplitHostPort(r.RemoteAddr)
+	if splitError != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+//parseRateLimitRule reads a rule like 60/1m, which allows 60 requests per minute with a burst of 60
+func parseRateLimitRule(value string) (rateLimitRule, error){
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return rateLimitRule{}, fmt.Errorf("it has to be a number of requests per duration like 60/1m")
+	}
+
+	requests, requestsError := strconv.Atoi(strings.TrimSpace(parts[0]))
+	period, periodError := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if requestsError != nil || periodError != nil || requests < 1 || period <= 0 {
+		return rateLimitRule{}, fmt.Errorf("it has to be a number of requests per duration like 60/1m")
+	}
+
+	return rateLimitRule{Requests: requests, Period: period}, nil
+}
+
+//secondsUntil gives the whole seconds from now until the given time, rounded up
+func secondsUntil(moment time.Time) int{
+	return int(math.Ceil(time.Until(moment).Seconds()))
+}
+
+//secondsDuration converts a number of seconds into a duration
+func secondsDuration(seconds float64) time.Duration{
+	return time.Duration(seconds * float64(time.Second))
+}
+
+//nextUTCDay gives the start of the UTC day after the given time, when the daily quotas start again
+func nextUTCDay(now time.Time) time.Time{
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+//maxInt gives the greatest of two numbers
+func maxInt(first int, second int) int{
+	if first > second {
+		return first
+	}
+	return second
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"net/http"
+	"net/http/httptest"
+)
+
+/* Rate Limiter Tests */
+
+func TestRateLimiterTake(t *testing.T){
+	rule := rateLimitRule{Requests: 3, Period: 3 * time.Second}
+	start := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct{
+		key string
+		after time.Duration
+		allowed bool
+		remaining int
+		retryAfter time.Duration
+		reset time.Duration
+	}{
+		{"list ip:1", 0, true, 2, 0, time.Second},
+		{"list ip:1", 0, true, 1, 0, 2 * time.Second},
+		{"list ip:1", 0, true, 0, time.Second, 3 * time.Second},
+		{"list ip:1", 0, false, 0, time.Second, 3 * time.Second},
+		{"list ip:2", 0, true, 2, 0, time.Second},
+		{"list ip:1", 500 * time.Millisecond, false, 0, 500 * time.Millisecond, 2500 * time.Millisecond},
+		{"list ip:1", time.Second, true, 0, time.Second, 3 * time.Second},
+		{"list ip:1", 30 * time.Second, true, 2, 0, time.Second},
+	}
+
+	limiter := newRateLimiter(nil, rule, rule, 0)
+	for index, test := range tests {
+		now := start.Add(test.after)
+		allowed, remaining, retryAfter, reset := limiter.take(test.key, rule, now)
+
+		if allowed != test.allowed || remaining != test.remaining {
+			t.Errorf("take %d of %s after %v gave allowed %v and %d remaining, %v and %d expected",
+				index, test.key, test.after, allowed, remaining, test.allowed, test.remaining)
+		}
+
+		//The retry time only matters when the request is refused
+		if (!allowed && retryAfter.Sub(now) != test.retryAfter) || reset.Sub(now) != test.reset {
+			t.Errorf("take %d of %s after %v gave the retry after %v and the reset %v, %v and %v expected",
+				index, test.key, test.after, retryAfter.Sub(now), reset.Sub(now), test.retryAfter, test.reset)
+		}
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T){
+	rule := rateLimitRule{Requests: 1, Period: time.Second}
+	limiter := newRateLimiter(nil, rule, rule, 0)
+	start := limiter.lastSweep
+
+	limiter.take(listRateClass + " ip:1", rule, start)
+	limiter.take(searchRateClass + " ip:2", rule, start.Add(rateBucketSweepInterval))
+
+	if _, kept := limiter.buckets[listRateClass + " ip:1"]; kept {
+		t.Errorf("the full bucket was not forgotten by the sweep")
+	}
+	if _, kept := limiter.buckets[searchRateClass + " ip:2"]; !kept {
+		t.Errorf("the bucket in use was forgotten by the sweep")
+	}
+}
+
+func TestGuardAuthentication(t *testing.T){
+	rule := rateLimitRule{Requests: 2, Period: time.Hour}
+	limiter := newRateLimiter(nil, rule, rule, 0)
+
+	//The authentication accepts only the key "valid"
+	handler := limiter.guardAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		if r.Header.Get("X-API-Key") != "valid" {
+			writeError(w, r, newUnauthorizedError("The API key is not valid or it was revoked"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct{
+		address string
+		key string
+		status int
+	}{
+		{"10.0.0.1:1000", "valid", http.StatusOK},
+		{"10.0.0.1:1000", "valid", http.StatusOK},
+		{"10.0.0.1:1000", "valid", http.StatusOK},
+		{"10.0.0.1:1000", "guess-1", http.StatusUnauthorized},
+		{"10.0.0.1:1001", "", http.StatusUnauthorized},
+		{"10.0.0.1:1002", "guess-2", http.StatusTooManyRequests},
+		{"10.0.0.1:1003", "valid", http.StatusTooManyRequests},
+		{"10.0.0.2:1000", "guess-3", http.StatusUnauthorized},
+	}
+
+	for index, test := range tests {
+		r := httptest.NewRequest("GET", "/songs", nil)
+		r.RemoteAddr = test.address
+		if test.key != "" {
+			r.Header.Set("X-API-Key", test.key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("request %d from %s with the key %q got the status %d, %d expected", index, test.address, test.key, w.Code, test.status)
+		}
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("request %d got the status 429 without Retry-After", index)
+		}
+	}
+}
+
+func TestParseRateLimitRule(t *testing.T){
+	tests := []struct{
+		value string
+		rule rateLimitRule
+		valid bool
+	}{
+		{"60/1m", rateLimitRule{60, time.Minute}, true},
+		{" 10 / 1s ", rateLimitRule{10, time.Second}, true},
+		{"60", rateLimitRule{}, false},
+		{"0/1m", rateLimitRule{}, false},
+		{"60/0s", rateLimitRule{}, false},
+		{"many/1m", rateLimitRule{}, false},
+		{"60/minute", rateLimitRule{}, false},
+	}
+
+	for _, test := range tests {
+		rule, ruleError := parseRateLimitRule(test.value)
+		if (ruleError == nil) != test.valid || rule != test.rule {
+			t.Errorf("parseRateLimitRule(%q) gave %v and the error %v, %v expected", test.value, rule, ruleError, test.rule)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+/* Constants */
+
+//Marks put by FTS5 around the matched text, they are control characters so they can not be confused with the escaped text
+const highlightStart = "\x02"
+const highlightEnd = "\x03"
+
+//Tags put around the matched text in the highlights of the search results
+const highlightStartTag = "<mark>"
+const highlightEndTag = "</mark>"
+
+/* Search Functions */
+
+//parseSearchQuery translates the text searched by the client into a FTS5 query.
+//Words between double quotes are searched as a phrase, a word or phrase ending with * matches
+//any word that starts with it, and every word or phrase has to be found in the song
+func parseSearchQuery(text string) (string, error){
+	terms := []string{}
+
+	remaining := strings.TrimSpace(text)
+	for remaining != "" {
+		var term string
+
+		if remaining[0] == '"' {
+
+			//Phrase until the closing double quote
+			end := strings.IndexByte(remaining[1:], '"')
+			if end < 0 {
+				return "", newBadRequestError("The phrase is not closed with a double quote: " + remaining)
+			}
+			term = remaining[1:end+1]
+			remaining = remaining[end+2:]
+		}else{
+
+			//Word until the next space or phrase
+			end := strings.IndexFunc(remaining, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+			if end < 0 {
+				end = len(remaining)
+			}
+			term = remaining[:end]
+			remaining = remaining[end:]
+		}
+
+		prefix := strings.HasPrefix(remaining, "*")
+		if prefix {
+			remaining = remaining[1:]
+		}else if strings.HasSuffix(term, "*") {
+			term = strings.TrimRight(term, "*")
+			prefix = true
+		}
+
+		remaining = strings.TrimLeftFunc(remaining, unicode.IsSpace)
+
+		//Every term is quoted so the text of the client can not use the FTS5 operators
+		if term = strings.TrimSpace(term); term != "" {
+			quoted := "\"" + strings.Replace(term, "\"", "\"\"", -1) + "\""
+			if prefix {
+				quoted += "*"
+			}
+			terms = append(terms, quoted)
+		}
+	}
+
+	if len(terms) == 0 {
+		return "", newBadRequestError("The text to search is required in the q parameter")
+	}
+
+	return strings.Join(terms, " "), nil
+}
+
+//highlightText escapes the HTML of a text highlighted by FTS5 and puts the <mark> tags around its matched parts,
+//so the text of the songs can not add its own HTML to the highlights
+func highlightText(text string) string{
+	escaped := html.EscapeString(text)
+	return strings.NewReplacer(highlightStart, highlightStartTag, highlightEnd, highlightEndTag).Replace(escaped)
+}
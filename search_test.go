@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+)
+
+/* Search Tests */
+
+func TestParseSearchQuery(t *testing.T){
+	tests := []struct{
+		text string
+		query string
+		valid bool
+	}{
+		{"beatles", `"beatles"`, true},
+		{"  let   it be ", `"let" "it" "be"`, true},
+		{`"let it be"`, `"let it be"`, true},
+		{`"let it be" beatles`, `"let it be" "beatles"`, true},
+		{`beatles"let it be"`, `"beatles" "let it be"`, true},
+		{"beat*", `"beat"*`, true},
+		{`"let it"*`, `"let it"*`, true},
+		{"AND OR NOT", `"AND" "OR" "NOT"`, true},
+		{"artist:beatles", `"artist:beatles"`, true},
+		{`say "hi`, "", false},
+		{`""`, "", false},
+		{"*", "", false},
+		{"   ", "", false},
+	}
+
+	for _, test := range tests {
+		query, queryError := parseSearchQuery(test.text)
+		if (queryError == nil) != test.valid {
+			t.Errorf("parseSearchQuery(%q) gave the error %v, valid %v expected", test.text, queryError, test.valid)
+			continue
+		}
+		if query != test.query {
+			t.Errorf("parseSearchQuery(%q) gave %s, %s expected", test.text, query, test.query)
+		}
+	}
+}
+
+func TestHighlightText(t *testing.T){
+	tests := []struct{
+		text string
+		highlighted string
+	}{
+		{"Let It Be", "Let It Be"},
+		{highlightStart + "Let" + highlightEnd + " It Be", "<mark>Let</mark> It Be"},
+		{"<script>" + highlightStart + "x" + highlightEnd + "</script>", "&lt;script&gt;<mark>x</mark>&lt;/script&gt;"},
+		{"Simon & Garfunkel", "Simon &amp; Garfunkel"},
+		{"\"quoted\" 'text'", "&#34;quoted&#34; &#39;text&#39;"},
+	}
+
+	for _, test := range tests {
+		if highlighted := highlightText(test.text); highlighted != test.highlighted {
+			t.Errorf("highlightText(%q) gave %s, %s expected", test.text, highlighted, test.highlighted)
+		}
+	}
+}
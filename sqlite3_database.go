@@ -2,128 +2,607 @@ package main
 
 import (
 	"fmt"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"context"
 
 	"database/sql"
     _ "github.com/mattn/go-sqlite3"
+	"golang.org/x/net/trace"
 )
 
 /* Constants */
 
-//File path of the database
-const databaseFilePath = "./jrdd.db"
+//Longest time that a connection of the pool is reused
+const connectionMaxLifetime = time.Hour
+
+/* Types */
+
+//rowQueryer runs a query that gives one row, it is a *sql.DB or a *sql.Tx
+type rowQueryer interface{
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+/* Errors */
+
+//errGenreInUse is given when a genre can not be deleted because some songs still reference it
+var errGenreInUse = errors.New("The genre is still referenced by some songs")
 
 /* Database Functions */
 
-//initDatabase initializes and opens the database located in the given filePath
-func initDatabase(filePath string) *sql.DB{
-	database, databaseError := sql.Open("sqlite3", filePath)
+//initDatabase initializes and opens the database located in the given filePath.
+//The returned database is a pool of connections meant to be shared by all the requests,
+//and each connection waits up to busyTimeout for a locked database
+func initDatabase(filePath string, busyTimeout time.Duration, maxOpenConnections int) (*sql.DB, error){
+	dataSourceName := fmt.Sprintf("%s?_busy_timeout=%d&_txlock=immediate", filePath, int(busyTimeout / time.Millisecond))
+
+	databaseEvents = trace.NewEventLog("database", filePath)
 
+	database, databaseError := sql.Open("sqlite3", dataSourceName)
 	if databaseError != nil {
-        fmt.Println("Something went wrong openning the database: " + filePath)
-        fmt.Println(databaseError)
-    }
+		databaseEvents.Errorf("open failed: %v", databaseError)
+		return nil, databaseError
+	}
 
-    return database 
-}
+	database.SetMaxOpenConns(maxOpenConnections)
+	database.SetMaxIdleConns(maxOpenConnections)
+	database.SetConnMaxLifetime(connectionMaxLifetime)
 
-//findAllSongsDB gets all songs in database by executing a sql statement
-func findAllSongsDB(database *sql.DB) *sql.Rows{
-	sqlStatement := "SELECT S.ID, S.artist, S.song, G.name, S.length FROM songs as S INNER JOIN genres as G on S.genre = G.ID"
+	//WAL mode lets readers go on while a song is written, it is stored in the database file
+	var journalMode string
+	journalError := database.QueryRow("PRAGMA journal_mode=WAL").Scan(&journalMode)
+	if journalError != nil {
+		databaseEvents.Errorf("journal mode failed: %v", journalError)
+		database.Close()
+		return nil, journalError
+	}
 
-	//Execute the query over the database
-	rows := executeQuery(database, sqlStatement)
+	databaseEvents.Printf("opened with journal mode %s, busy timeout %v and up to %d connections", journalMode, busyTimeout, maxOpenConnections)
 
-    return rows
+	return database, nil
 }
 
-//findSongByArtistDB gets the songs in database that match with the given artist
-func findSongByArtistDB(database *sql.DB, artist string) *sql.Rows{
-	sqlStatement := "SELECT S.ID, S.artist, S.song, G.name, S.length FROM (SELECT * FROM songs WHERE artist LIKE ?) as S" + 
-																		" INNER JOIN genres as G on S.genre = G.ID"
+//songFilter holds the criteria that the songs have to match. Empty texts and negative lengths are not used
+type songFilter struct{
+	Artist string
+	Song string
+	Genre string
+	MinLength int
+	MaxLength int
+}
 
-	parameter := "%" + artist + "%"
+//newSongFilter creates a filter that matches all the songs
+func newSongFilter() songFilter{
+	return songFilter{
+		MinLength: -1,
+		MaxLength: -1,
+	}
+}
 
-	//Execute the query over the database
-	rows := executeQuery(database, sqlStatement, parameter)
+//conditions gives the sql conditions of the criteria used in the filter and their parameters
+func (filter songFilter) conditions() ([]string, []interface{}){
+	conditions := []string{}
+	params := []interface{}{}
 
-    return rows
+	if filter.Artist != "" {
+		conditions = append(conditions, "S.artist LIKE ?")
+		params = append(params, "%" + filter.Artist + "%")
+	}
+	if filter.Song != "" {
+		conditions = append(conditions, "S.song LIKE ?")
+		params = append(params, "%" + filter.Song + "%")
+	}
+	if filter.Genre != "" {
+		conditions = append(conditions, "G.name LIKE ?")
+		params = append(params, "%" + filter.Genre + "%")
+	}
+	if filter.MinLength >= 0 {
+		conditions = append(conditions, "IFNULL(S.length, 0) >= ?")
+		params = append(params, filter.MinLength)
+	}
+	if filter.MaxLength >= 0 {
+		conditions = append(conditions, "IFNULL(S.length, 0) <= ?")
+		params = append(params, filter.MaxLength)
+	}
+
+	return conditions, params
 }
 
-//findSongBySongDB gets the songs in database that match with the given song
-func findSongBySongDB(database *sql.DB, song string) *sql.Rows{
-	sqlStatement := "SELECT S.ID, S.artist, S.song, G.name, S.length FROM (SELECT * FROM songs WHERE song LIKE ?) as S" + 
-																		" INNER JOIN genres as G on S.genre = G.ID"
+//findSongsDB gets a page of the songs in database that match with all the criteria of the filter, and the total number of them
+func findSongsDB(ctx context.Context, database *sql.DB, filter songFilter, options listOptions) (resultRows, int, error){
+	return findFilteredSongsDB(ctx, database, "findSongsDB", filter, options)
+}
+
+//findFilteredSongsDB gets the songs that match with the filter like findSongsDB, and records the query duration
+//with the name of the function that called it, so each lookup keeps its own label in the metrics
+func findFilteredSongsDB(ctx context.Context, database *sql.DB, function string, filter songFilter, options listOptions) (resultRows, int, error){
+	defer observeQuery(function, time.Now())
+
+	//The length and the genre can be NULL in the schema, they are given as 0 and an empty name
+	sqlStatement := "SELECT S.ID, S.artist, S.song, IFNULL(G.name, '') as name, IFNULL(S.length, 0) as length FROM songs as S INNER JOIN genres as G on S.genre = G.ID"
 
-	parameter := "%" + song + "%"
+	//Only the conditions are added to the statement, the values are given as parameters
+	conditions, params := filter.conditions()
+	if len(conditions) > 0 {
+		sqlStatement += " WHERE " + strings.Join(conditions, " AND ")
+	}
 
 	//Execute the query over the database
-    rows := executeQuery(database, sqlStatement, parameter)
+	return findSongsPageDB(ctx, database, sqlStatement, options, params...)
+}
+
+//findSongByArtistDB gets a page of the songs in database that match with the given artist, and the total number of them
+func findSongByArtistDB(ctx context.Context, database *sql.DB, artist string, options listOptions) (resultRows, int, error){
+	filter := newSongFilter()
+	filter.Artist = artist
 
-    return rows
+	return findFilteredSongsDB(ctx, database, "findSongByArtistDB", filter, options)
 }
 
-//findSongByGenreDB gets the songs in database that match with the given genre
-func findSongByGenreDB(database *sql.DB, genre string) *sql.Rows{
-	sqlStatement := "SELECT S.ID, S.artist, S.song, G.name, S.length FROM songs as S INNER JOIN genres as G on S.genre = G.ID " + 
-																					"WHERE G.name LIKE ?"
-	
-	parameter := "%" + genre + "%"
+//findSongBySongDB gets a page of the songs in database that match with the given song, and the total number of them
+func findSongBySongDB(ctx context.Context, database *sql.DB, song string, options listOptions) (resultRows, int, error){
+	filter := newSongFilter()
+	filter.Song = song
 
-	//Execute the query over the database
-	rows := executeQuery(database, sqlStatement, parameter)																				
+	return findFilteredSongsDB(ctx, database, "findSongBySongDB", filter, options)
+}
+
+//findSongByGenreDB gets a page of the songs in database that match with the given genre, and the total number of them
+func findSongByGenreDB(ctx context.Context, database *sql.DB, genre string, options listOptions) (resultRows, int, error){
+	filter := newSongFilter()
+	filter.Genre = genre
 
-    return rows
+	return findFilteredSongsDB(ctx, database, "findSongByGenreDB", filter, options)
 }
- 
-//findSongByLengthDB gets the songs in database that have a length between a minimum and maximum
-func findSongByLengthDB(database *sql.DB, minLength string, maxLength string) *sql.Rows{
-	sqlStatement := "SELECT S.ID, S.artist, S.song, G.name, S.length FROM (SELECT * FROM songs WHERE length BETWEEN ? AND ?) as S" + 
-																		" INNER JOIN genres as G on S.genre = G.ID"
 
-	//Execute the query over the database
-	rows := executeQuery(database, sqlStatement, minLength, maxLength)																				
+//findSongByLengthDB gets a page of the songs in database that have a length between a minimum and maximum, and the total number of them.
+//A bound given as -1 leaves that end of the range open
+func findSongByLengthDB(ctx context.Context, database *sql.DB, minLength int, maxLength int, options listOptions) (resultRows, int, error){
+	filter := newSongFilter()
+	filter.MinLength = minLength
+	filter.MaxLength = maxLength
 
-    return rows
+	return findFilteredSongsDB(ctx, database, "findSongByLengthDB", filter, options)
 }
 
 //findAllGenresDB gets all genres in database and gives the number of songs and the total length of all songs by genre
-func findAllGenresDB(database *sql.DB) *sql.Rows{
+func findAllGenresDB(ctx context.Context, database *sql.DB) (resultRows, error){
+	defer observeQuery("findAllGenresDB", time.Now())
+
 	sqlStatement := "SELECT G.name as Genre, COUNT(S.ID) as NumberOfSongs, IFNULL(SUM(S.length), 0 ) as TotalLength FROM genres as G " + 
 																		" LEFT OUTER JOIN songs as S on G.ID = S.genre GROUP BY G.name"
 
-	//Execute the query over the database
-	rows := executeQuery(database, sqlStatement)
+	//Execute the query over the database, or take its rows from the query cache
+	rows, rowsError := executeCachedQuery(ctx, database, sqlStatement)
+
+    return rows, rowsError
+}
+
+//findSongsPageDB gets the page of the songs selected by the given sql statement that is asked in the options,
+//and the total number of songs selected by the statement
+func findSongsPageDB(ctx context.Context, database *sql.DB, sqlStatement string, options listOptions, params ...interface{}) (resultRows, int, error){
+
+	//Count all the songs selected by the statement
+	total, totalError := queryCachedTotal(ctx, database, "SELECT COUNT(*) FROM (" + sqlStatement + ")", params...)
+	if totalError != nil {
+		return nil, 0, totalError
+	}
+
+	sortColumn := songSortColumns[options.Sort]
+	direction := "ASC"
+	if options.Descending {
+		direction = "DESC"
+	}
+
+	//A page that ends before the cursor is read backwards from it, and sorted again later
+	before := options.Cursor != nil && options.Cursor.Before
+	pageDirection, cursorComparison := "ASC", ">"
+	if options.Descending != before {
+		pageDirection, cursorComparison = "DESC", "<"
+	}
+
+	//Keep only the songs after the cursor, the ID breaks the ties between equal values
+	condition := "1 = 1"
+	pageParams := append([]interface{}{}, params...)
+	if options.Cursor != nil {
+		condition = fmt.Sprintf("(%s %s ? OR (%s = ? AND ID %s ?))", sortColumn, cursorComparison, sortColumn, cursorComparison)
+		pageParams = append(pageParams, options.Cursor.Value, options.Cursor.Value, options.Cursor.ID)
+	}
+
+	pageStatement := "SELECT ID, artist, song, name, length FROM (" + sqlStatement + ") WHERE " + condition +
+		" ORDER BY " + sortColumn + " " + pageDirection + ", ID " + pageDirection + " LIMIT ? OFFSET ?"
+	pageParams = append(pageParams, options.Limit, options.Offset)
+
+	if before {
+		pageStatement = "SELECT * FROM (" + pageStatement + ") ORDER BY " + sortColumn + " " + direction + ", ID " + direction
+	}
 
-    return rows
+	//Execute the query over the database, or take its rows from the query cache
+	rows, rowsError := executeCachedQuery(ctx, database, pageStatement, pageParams...)
+
+	return rows, total, rowsError
 }
 
 //executeQuery executes a query over the database with the given parameters 
-func executeQuery (database *sql.DB, sqlStatement string, params ...string) *sql.Rows{
+func executeQuery(ctx context.Context, database *sql.DB, sqlStatement string, params ...interface{}) (*sql.Rows, error){
 
 	//Prepare the sql statement
-	sqlStmtPrepared, sqlStmtError := database.Prepare(sqlStatement)
+	traceEvent(ctx, "prepare %s", describeStatement(sqlStatement))
+	sqlStmtPrepared, sqlStmtError := database.PrepareContext(ctx, sqlStatement)
+	if sqlStmtError != nil {
+		traceQueryError(ctx, sqlStatement, sqlStmtError)
+		return nil, sqlStmtError
+	}
+	defer sqlStmtPrepared.Close()
+
+	//Execute the sql statement
+	traceEvent(ctx, "execute with %d parameters", len(params))
+	rows, rowsError := sqlStmtPrepared.QueryContext(ctx, params...)
+	if rowsError != nil {
+		traceQueryError(ctx, sqlStatement, rowsError)
+	}
+
+	return rows, rowsError
+}
+
+//queryRow executes a query that gives one row with the given parameters, its error is given when the row is read
+func queryRow(ctx context.Context, queryer rowQueryer, sqlStatement string, params ...interface{}) *sql.Row{
+	traceEvent(ctx, "execute %s with %d parameters", describeStatement(sqlStatement), len(params))
+
+	return queryer.QueryRowContext(ctx, sqlStatement, params...)
+}
+
+//findSongByIDDB gets the song in database with the given ID
+func findSongByIDDB(ctx context.Context, database *sql.DB, id int) (Song, error){
+	defer observeQuery("findSongByIDDB", time.Now())
+
+	sqlStatement := "SELECT S.ID, S.artist, S.song, IFNULL(G.name, '') as name, IFNULL(S.length, 0) as length FROM songs as S INNER JOIN genres as G on S.genre = G.ID " +
+																					"WHERE S.ID = ?"
+
+	song := Song{}
+
+	//Execute the query over the database and read the only row
+	songError := queryRow(ctx, database, sqlStatement, id).Scan(
+		&song.ID,
+		&song.Artist,
+		&song.Song,
+		&song.Genre,
+		&song.Length)
+
+	return song, songError
+}
+
+//findGenreIDDB gets the ID of the genre that match with the given name or ID
+func findGenreIDDB(ctx context.Context, database *sql.DB, genre string) (int, error){
+	defer observeQuery("findGenreIDDB", time.Now())
+
+	sqlStatement := "SELECT ID FROM genres WHERE name = ? COLLATE NOCASE"
+
+	//A numeric genre is taken as the ID of the genre
+	if _, numberError := strconv.Atoi(genre); numberError == nil {
+		sqlStatement = "SELECT ID FROM genres WHERE ID = ?"
+	}
+
+	var genreID int
+	genreError := queryRow(ctx, database, sqlStatement, genre).Scan(&genreID)
+
+	return genreID, genreError
+}
+
+//insertSongDB inserts the given song in database and gives the ID of the new song
+func insertSongDB(ctx context.Context, database *sql.DB, song Song, genreID int) (int, error){
+	defer observeQuery("insertSongDB", time.Now())
+
+	sqlStatement := "INSERT INTO songs (artist, song, genre, length) VALUES (?, ?, ?, ?)"
+
+	//Execute the statement over the database
+	result, resultError := executeStatement(ctx, database, sqlStatement, song.Artist, song.Song, genreID, song.Length)
+	if resultError != nil {
+		return 0, resultError
+	}
+
+	songID, songIDError := result.LastInsertId()
+
+	return int(songID), songIDError
+}
+
+//updateSongDB replaces the song in database that has the given ID and gives the number of updated songs
+func updateSongDB(ctx context.Context, database *sql.DB, id int, song Song, genreID int) (int, error){
+	defer observeQuery("updateSongDB", time.Now())
+
+	sqlStatement := "UPDATE songs SET artist = ?, song = ?, genre = ?, length = ? WHERE ID = ?"
+
+	//Execute the statement over the database
+	result, resultError := executeStatement(ctx, database, sqlStatement, song.Artist, song.Song, genreID, song.Length, id)
+	if resultError != nil {
+		return 0, resultError
+	}
+
+	updatedSongs, updatedSongsError := result.RowsAffected()
+
+	return int(updatedSongs), updatedSongsError
+}
+
+//deleteSongDB deletes the song in database that has the given ID and gives the number of deleted songs
+func deleteSongDB(ctx context.Context, database *sql.DB, id int) (int, error){
+	defer observeQuery("deleteSongDB", time.Now())
+
+	sqlStatement := "DELETE FROM songs WHERE ID = ?"
+
+	//Execute the statement over the database
+	result, resultError := executeStatement(ctx, database, sqlStatement, id)
+	if resultError != nil {
+		return 0, resultError
+	}
+
+	deletedSongs, deletedSongsError := result.RowsAffected()
+
+	return int(deletedSongs), deletedSongsError
+}
 
+//executeStatement executes a statement that modifies the database with the given parameters
+func executeStatement(ctx context.Context, database *sql.DB, sqlStatement string, params ...interface{}) (sql.Result, error){
+
+	//Prepare the sql statement
+	traceEvent(ctx, "prepare %s", describeStatement(sqlStatement))
+	sqlStmtPrepared, sqlStmtError := database.PrepareContext(ctx, sqlStatement)
 	if sqlStmtError != nil {
-		fmt.Println("Something went wrong preparing the sql statement: " + sqlStatement)
-        fmt.Println(sqlStmtError)
+		traceQueryError(ctx, sqlStatement, sqlStmtError)
+		return nil, sqlStmtError
 	}
 	defer sqlStmtPrepared.Close()
 
 	//Execute the sql statement
-	var rows *sql.Rows
-	var rowsError error
-	if len(params) == 1 {
-        rows, rowsError = sqlStmtPrepared.Query(params[0])
-    }else if len(params) == 2 {
-        rows, rowsError = sqlStmtPrepared.Query(params[0], params[1])
-    }else{
-    	rows, rowsError = sqlStmtPrepared.Query()
-    }
-    
-    if rowsError != nil {
-    	fmt.Println("Something went wrong executing the sql statement: " + sqlStatement)
-        fmt.Println(rowsError)
-    }
-    
-    return rows
-}
\ No newline at end of file
+	traceEvent(ctx, "execute with %d parameters", len(params))
+	result, resultError := sqlStmtPrepared.ExecContext(ctx, params...)
+	if resultError != nil {
+		traceQueryError(ctx, sqlStatement, resultError)
+	}
+
+	return result, resultError
+}
+
+//findGenreByIDDB gets the genre in database with the given ID, the number of its songs and their total length
+func findGenreByIDDB(ctx context.Context, database *sql.DB, id int) (Genre, error){
+	defer observeQuery("findGenreByIDDB", time.Now())
+
+	sqlStatement := "SELECT G.name as Genre, COUNT(S.ID) as NumberOfSongs, IFNULL(SUM(S.length), 0 ) as TotalLength FROM genres as G " +
+																		" LEFT OUTER JOIN songs as S on G.ID = S.genre WHERE G.ID = ? GROUP BY G.name"
+
+	genre := Genre{}
+
+	//Execute the query over the database and read the only row
+	genreError := queryRow(ctx, database, sqlStatement, id).Scan(
+		&genre.Genre,
+		&genre.NumberOfSongs,
+		&genre.TotalLength)
+
+	return genre, genreError
+}
+
+//insertGenreDB inserts a genre with the given name in database and gives the ID of the new genre
+func insertGenreDB(ctx context.Context, database *sql.DB, name string) (int, error){
+	defer observeQuery("insertGenreDB", time.Now())
+
+	sqlStatement := "INSERT INTO genres (name) VALUES (?)"
+
+	//Execute the statement over the database
+	result, resultError := executeStatement(ctx, database, sqlStatement, name)
+	if resultError != nil {
+		return 0, resultError
+	}
+
+	genreID, genreIDError := result.LastInsertId()
+
+	return int(genreID), genreIDError
+}
+
+//renameGenreDB changes the name of the genre in database that has the given ID and gives the number of updated genres
+func renameGenreDB(ctx context.Context, database *sql.DB, id int, name string) (int, error){
+	defer observeQuery("renameGenreDB", time.Now())
+
+	sqlStatement := "UPDATE genres SET name = ? WHERE ID = ?"
+
+	//Execute the statement over the database
+	result, resultError := executeStatement(ctx, database, sqlStatement, name, id)
+	if resultError != nil {
+		return 0, resultError
+	}
+
+	updatedGenres, updatedGenresError := result.RowsAffected()
+
+	return int(updatedGenres), updatedGenresError
+}
+
+//deleteGenreDB deletes the genre in database that has the given ID and gives the number of songs moved to the
+//target genre. When targetID is 0 the genre is only deleted if no song references it, otherwise errGenreInUse is given
+func deleteGenreDB(ctx context.Context, database *sql.DB, id int, targetID int) (int, error){
+	defer observeQuery("deleteGenreDB", time.Now())
+
+	//Songs are moved and the genre deleted in the same transaction
+	transaction, transactionError := database.BeginTx(ctx, nil)
+	if transactionError != nil {
+		return 0, transactionError
+	}
+	defer transaction.Rollback()
+
+	var numberOfSongs int
+	countError := queryRow(ctx, transaction, "SELECT COUNT(*) FROM songs WHERE genre = ?", id).Scan(&numberOfSongs)
+	if countError != nil {
+		return 0, countError
+	}
+
+	if numberOfSongs > 0 {
+		if targetID == 0 {
+			return 0, errGenreInUse
+		}
+
+		//Move the songs to the target genre
+		traceEvent(ctx, "move the songs of the genre %d to the genre %d", id, targetID)
+		_, moveError := transaction.ExecContext(ctx, "UPDATE songs SET genre = ? WHERE genre = ?", targetID, id)
+		if moveError != nil {
+			return 0, moveError
+		}
+	}
+
+	traceEvent(ctx, "delete the genre %d", id)
+	result, deleteError := transaction.ExecContext(ctx, "DELETE FROM genres WHERE ID = ?", id)
+	if deleteError != nil {
+		return 0, deleteError
+	}
+
+	deletedGenres, deletedGenresError := result.RowsAffected()
+	if deletedGenresError != nil {
+		return 0, deletedGenresError
+	}
+	if deletedGenres == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	return numberOfSongs, transaction.Commit()
+}
+
+//searchSongsDB gets a page of the songs in database that match with the given FTS5 query, sorted by their BM25 relevance,
+//and the total number of them
+func searchSongsDB(ctx context.Context, database *sql.DB, query string, limit int, offset int) (resultRows, int, error){
+	defer observeQuery("searchSongsDB", time.Now())
+
+	//Count all the songs that match with the query
+	total, totalError := queryCachedTotal(ctx, database, "SELECT COUNT(*) FROM songs_search WHERE songs_search MATCH ?", query)
+	if totalError != nil {
+		return nil, 0, totalError
+	}
+
+	sqlStatement := "SELECT S.ID, S.artist, S.song, IFNULL(G.name, ''), IFNULL(S.length, 0), bm25(songs_search) as rank, " +
+		"highlight(songs_search, 0, ?, ?), highlight(songs_search, 1, ?, ?), highlight(songs_search, 2, ?, ?) " +
+		"FROM songs_search INNER JOIN songs as S on S.ID = songs_search.rowid INNER JOIN genres as G on S.genre = G.ID " +
+		"WHERE songs_search MATCH ? ORDER BY rank, S.ID LIMIT ? OFFSET ?"
+
+	//Execute the query over the database, or take its rows from the query cache
+	rows, rowsError := executeCachedQuery(ctx, database, sqlStatement,
+		highlightStart, highlightEnd, highlightStart, highlightEnd, highlightStart, highlightEnd,
+		query, limit, offset)
+
+	return rows, total, rowsError
+}
+
+//insertAPIKeyDB stores an API key with the given name, prefix, hash and role and gives the ID of the new key
+func insertAPIKeyDB(ctx context.Context, database *sql.DB, name string, prefix string, hash string, role string) (int, error){
+	defer observeQuery("insertAPIKeyDB", time.Now())
+
+	sqlStatement := "INSERT INTO api_keys (name, prefix, hash, role, created_at) VALUES (?, ?, ?, ?, ?)"
+
+	//Execute the statement over the database
+	result, resultError := executeStatement(ctx, database, sqlStatement, name, prefix, hash, role, time.Now().UTC().Format(time.RFC3339))
+	if resultError != nil {
+		return 0, resultError
+	}
+
+	keyID, keyIDError := result.LastInsertId()
+
+	return int(keyID), keyIDError
+}
+
+//findAPIKeyByHashDB gets the API key in database that has the given hash and was not revoked
+func findAPIKeyByHashDB(ctx context.Context, database *sql.DB, hash string) (apiKey, error){
+	defer observeQuery("findAPIKeyByHashDB", time.Now())
+
+	sqlStatement := "SELECT ID, name, prefix, role, created_at FROM api_keys WHERE hash = ? AND revoked_at IS NULL"
+
+	key := apiKey{}
+
+	//Execute the query over the database and read the only row
+	keyError := queryRow(ctx, database, sqlStatement, hash).Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.Role,
+		&key.CreatedAt)
+
+	return key, keyError
+}
+
+//findAllAPIKeysDB gets all the API keys in database, including the revoked ones
+func findAllAPIKeysDB(ctx context.Context, database *sql.DB) (*sql.Rows, error){
+	defer observeQuery("findAllAPIKeysDB", time.Now())
+
+	sqlStatement := "SELECT ID, name, prefix, role, created_at, IFNULL(revoked_at, '') FROM api_keys ORDER BY ID"
+
+	//Execute the query over the database
+	return executeQuery(ctx, database, sqlStatement)
+}
+
+//revokeAPIKeyDB revokes the API key in database that has the given ID or prefix and gives the number of revoked keys.
+//The ID is compared as a text, otherwise a prefix made only of digits like 00000004 would also match the key 4
+func revokeAPIKeyDB(ctx context.Context, database *sql.DB, key string) (int, error){
+	defer observeQuery("revokeAPIKeyDB", time.Now())
+
+	sqlStatement := "UPDATE api_keys SET revoked_at = ? WHERE (prefix = ? OR CAST(ID AS TEXT) = ?) AND revoked_at IS NULL"
+
+	//Execute the statement over the database
+	result, resultError := executeStatement(ctx, database, sqlStatement, time.Now().UTC().Format(time.RFC3339), key, key)
+	if resultError != nil {
+		return 0, resultError
+	}
+
+	revokedKeys, revokedKeysError := result.RowsAffected()
+
+	return int(revokedKeys), revokedKeysError
+}
+
+//countDailyRequestDB counts a request of the client in the given day and gives the number of requests that it made that day.
+//The days before the given one are deleted, only the current day is needed
+func countDailyRequestDB(ctx context.Context, database *sql.DB, client string, day string) (int, error){
+	defer observeQuery("countDailyRequestDB", time.Now())
+
+	transaction, transactionError := database.BeginTx(ctx, nil)
+	if transactionError != nil {
+		return 0, transactionError
+	}
+	defer transaction.Rollback()
+
+	traceEvent(ctx, "count the request of %s in %s", client, day)
+	_, insertError := transaction.ExecContext(ctx, "INSERT OR IGNORE INTO request_quotas (client, day, requests) VALUES (?, ?, 0)", client, day)
+	if insertError != nil {
+		return 0, insertError
+	}
+
+	_, updateError := transaction.ExecContext(ctx, "UPDATE request_quotas SET requests = requests + 1 WHERE client = ? AND day = ?", client, day)
+	if updateError != nil {
+		return 0, updateError
+	}
+
+	_, deleteError := transaction.ExecContext(ctx, "DELETE FROM request_quotas WHERE client = ? AND day < ?", client, day)
+	if deleteError != nil {
+		return 0, deleteError
+	}
+
+	var requests int
+	countError := queryRow(ctx, transaction, "SELECT requests FROM request_quotas WHERE client = ? AND day = ?", client, day).Scan(&requests)
+	if countError != nil {
+		return 0, countError
+	}
+
+	return requests, transaction.Commit()
+}
+
+//catalogRevisionDB gets the revision of the catalog, which is increased by triggers on every change of the songs and genres,
+//and the time of the last change
+func catalogRevisionDB(ctx context.Context, database *sql.DB) (int, time.Time, error){
+	defer observeQuery("catalogRevisionDB", time.Now())
+
+	sqlStatement := "SELECT revision, modified_at FROM catalog_revision WHERE ID = 1"
+
+	var revision int
+	var modifiedAt string
+	revisionError := queryRow(ctx, database, sqlStatement).Scan(&revision, &modifiedAt)
+	if revisionError != nil {
+		return 0, time.Time{}, revisionError
+	}
+
+	modified, timeError := time.Parse(time.RFC3339, modifiedAt)
+
+	return revision, modified, timeError
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"encoding/csv"
+	"encoding/json"
+
+	"net/http"
+)
+
+/* Constants */
+
+//Number of songs written between two flushes of a streamed response
+const streamFlushInterval = 100
+
+//Trailer of a streamed response with the error that stopped it, since its status was already sent
+const streamErrorTrailer = "X-Stream-Error"
+
+/* Streaming Functions */
+
+//streamSongs writes the songs in the rows to the response while they are read, so the memory used does not grow
+//with the number of songs and the first songs are sent before the last ones are read. The response is flushed
+//every streamFlushInterval songs. When reading the rows fails after the status was sent, the JSON is still closed
+//and has the error in its Error field (error in the version 2), and the error is also sent in the X-Stream-Error trailer.
+//XML can not be written by parts and the Link header of a page reached by cursor depends on its last song,
+//so those songs are read before writing the response, which is bounded by the limit of the page
+func streamSongs(w http.ResponseWriter, r *http.Request, rows resultRows, total int, options listOptions){
+	format, formatError := negotiateFormat(r)
+	if formatError != nil {
+		writeError(w, r, formatError)
+		return
+	}
+
+	if format.Name == "xml" || options.CursorPaging {
+		songs, songsError := songRowsToList(rows)
+		if songsError != nil {
+			writeError(w, r, songsError)
+			return
+		}
+
+		bounds := pageBounds{}
+		for _, song := range songs {
+			bounds.add(song)
+		}
+
+		links := pageLinks(r, options, total, bounds)
+		writePageHeaders(w, total, links)
+		writeResultPage(w, r, SongsList{Songs: songs, Total: total}, links)
+		return
+	}
+
+	//Read the first song before sending the status, so an error of the query is still answered with its own status
+	song, hasSong, streamError := nextSong(rows)
+	if streamError != nil {
+		writeError(w, r, streamError)
+		return
+	}
+
+	links := pageLinks(r, options, total, pageBounds{})
+	writePageHeaders(w, total, links)
+
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", format.Disposition + "; filename=\"" + resultFileName(r, format) + "\"")
+	w.Header().Set("Trailer", streamErrorTrailer)
+	w.WriteHeader(http.StatusOK)
+
+	version := apiVersion(r)
+	csvWriter := csv.NewWriter(w)
+
+	//Write the start of the list
+	switch {
+	case format.Name == "json" && version == 2:
+		fmt.Fprint(w, `{"data":[`)
+	case format.Name == "json":
+		fmt.Fprint(w, `{"Songs":[`)
+	case format.Name == "csv":
+		csvWriter.Write(csvHeader(SongsList{}, version))
+	}
+
+	//Write each song as soon as it is read
+	bounds := pageBounds{}
+	for hasSong {
+		var item interface{} = song
+		if version == 2 {
+			item = songV2(song)
+		}
+
+		var writeSongError error
+		switch format.Name {
+		case "json", "ndjson":
+			jsonSong, _ := json.Marshal(item)
+			if format.Name == "ndjson" {
+				jsonSong = append(jsonSong, '\n')
+			}else if bounds.Count > 0 {
+				jsonSong = append([]byte(","), jsonSong...)
+			}
+			_, writeSongError = w.Write(jsonSong)
+
+		case "csv":
+			csvWriter.Write(csvRecord(item))
+			writeSongError = csvWriter.Error()
+		}
+
+		//The client went away, there is nobody to write the rest of the songs to
+		if writeSongError != nil {
+			traceEvent(r.Context(), "stopped streaming after %d songs: %v", bounds.Count, writeSongError)
+			return
+		}
+
+		bounds.add(song)
+		if bounds.Count % streamFlushInterval == 0 {
+			flushResponse(w, csvWriter)
+		}
+
+		song, hasSong, streamError = nextSong(rows)
+	}
+	traceEvent(r.Context(), "streamed %d songs of %s", bounds.Count, format.Name)
+
+	var clientError *apiError
+	if streamError != nil {
+		clientError = clientErrorOf(r, streamError)
+		traceEvent(r.Context(), "error streaming after %d songs %s: %s", bounds.Count, clientError.Code, clientError.Message)
+		w.Header().Set(streamErrorTrailer, clientError.Code + ": " + clientError.Message)
+	}
+
+	//Write the end of the list, with the error that stopped it
+	id := requestID(r)
+	switch {
+	case format.Name == "json" && version == 2:
+		document := documentV2(r, SongsList{Total: total}, links)
+		jsonMeta, _ := json.Marshal(document.Meta)
+		jsonLinks, _ := json.Marshal(document.Links)
+		fmt.Fprintf(w, `],"meta":%s,"links":%s`, jsonMeta, jsonLinks)
+		if clientError != nil {
+			jsonError, _ := json.Marshal(ErrorDetailV2{Code: clientError.Code, Message: clientError.Message})
+			fmt.Fprintf(w, `,"error":%s`, jsonError)
+		}
+		fmt.Fprint(w, `}`)
+
+	case format.Name == "json":
+		fmt.Fprint(w, `],"Total":` + strconv.Itoa(total))
+		if clientError != nil {
+			jsonError, _ := json.Marshal(ErrorDetail{Code: clientError.Code, Message: clientError.Message, RequestID: id})
+			fmt.Fprintf(w, `,"Error":%s`, jsonError)
+		}
+		fmt.Fprint(w, `}`)
+
+	case format.Name == "ndjson" && clientError != nil:
+		fmt.Fprintf(w, "%s\n", errorDocument(r, clientError, id))
+	}
+
+	csvWriter.Flush()
+}
+
+//nextSong reads the next song in the rows, and tells if there was one
+func nextSong(rows resultRows) (Song, bool, error){
+	song := Song{}
+	if !rows.Next() {
+		return song, false, rows.Err()
+	}
+
+	songError := rows.Scan(&song.ID, &song.Artist, &song.Song, &song.Genre, &song.Length)
+	if songError != nil {
+		return song, false, songError
+	}
+	return song, true, nil
+}
+
+//flushResponse sends to the client the part of the response written so far, including the buffered CSV records
+func flushResponse(w http.ResponseWriter, csvWriter *csv.Writer){
+	csvWriter.Flush()
+	if flusher, canFlush := w.(http.Flusher); canFlush {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+	"encoding/csv"
+	"encoding/json"
+
+	"net/http"
+	"net/http/httptest"
+)
+
+/* Types */
+
+//failingRows gives the cached rows and then fails, like a query that stops in the middle of the songs
+type failingRows struct{
+	*cachedRows
+	err error
+}
+
+//Err gives the error that stopped the rows
+func (rows *failingRows) Err() error{
+	return rows.err
+}
+
+/* Streaming Tests */
+
+func TestStreamSongsError(t *testing.T){
+	tests := []struct{
+		path string
+		check func(t *testing.T, body string)
+	}{
+		{"/songs?format=json", func(t *testing.T, body string){
+			document := struct{
+				Songs []Song
+				Total int
+				Error ErrorDetail
+			}{}
+			if decodeError := json.Unmarshal([]byte(body), &document); decodeError != nil {
+				t.Fatalf("the JSON can not be read: %v", decodeError)
+			}
+			if len(document.Songs) != 2 || document.Total != 3 || document.Error.Code != "internal_error" {
+				t.Errorf("the document has %d songs of %d and the error %q", len(document.Songs), document.Total, document.Error.Code)
+			}
+		}},
+		{"/v2/songs?format=json", func(t *testing.T, body string){
+			document := struct{
+				Data []SongV2 `json:"data"`
+				Meta MetaV2 `json:"meta"`
+				Links map[string]string `json:"links"`
+				Error ErrorDetailV2 `json:"error"`
+			}{}
+			if decodeError := json.Unmarshal([]byte(body), &document); decodeError != nil {
+				t.Fatalf("the JSON can not be read: %v", decodeError)
+			}
+			if len(document.Data) != 2 || document.Meta.APIVersion != 2 || document.Links["self"] == "" || document.Error.Code != "internal_error" {
+				t.Errorf("the document has %d songs, the version %d, the links %v and the error %q",
+					len(document.Data), document.Meta.APIVersion, document.Links, document.Error.Code)
+			}
+		}},
+		{"/songs?format=ndjson", func(t *testing.T, body string){
+			var lines []string
+			for scanner := bufio.NewScanner(strings.NewReader(body)); scanner.Scan(); {
+				lines = append(lines, scanner.Text())
+			}
+			if len(lines) != 3 {
+				t.Fatalf("the NDJSON has %d lines, 2 songs and the error expected", len(lines))
+			}
+
+			song, document := Song{}, ErrorResponse{}
+			if decodeError := json.Unmarshal([]byte(lines[1]), &song); decodeError != nil || song.ID != 2 {
+				t.Errorf("the second line %s is not the second song", lines[1])
+			}
+			if decodeError := json.Unmarshal([]byte(lines[2]), &document); decodeError != nil || document.Error.Code != "internal_error" {
+				t.Errorf("the last line %s is not the error", lines[2])
+			}
+		}},
+		{"/songs?format=csv", func(t *testing.T, body string){
+			records, readError := csv.NewReader(strings.NewReader(body)).ReadAll()
+			if readError != nil {
+				t.Fatalf("the CSV can not be read: %v", readError)
+			}
+			if len(records) != 3 || records[0][0] != "ID" || records[2][1] != "The Beatles" {
+				t.Errorf("the CSV is %v, the header and 2 songs expected", records)
+			}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T){
+			rows := &failingRows{
+				cachedRows: &cachedRows{rows: [][]interface{}{
+					{1, "The Beatles", "Help!", "Rock", 138},
+					{2, "The Beatles", "Yesterday", "Rock", 125},
+				}, index: -1},
+				err: errors.New("database disk image is malformed"),
+			}
+
+			w := httptest.NewRecorder()
+			streamSongs(w, httptest.NewRequest("GET", test.path, nil), rows, 3, listOptions{Limit: 10})
+			response := w.Result()
+
+			//The status was sent with the first song, the error comes in the trailer
+			if response.StatusCode != http.StatusOK {
+				t.Errorf("the status is %d, 200 expected", response.StatusCode)
+			}
+			if trailer := response.Trailer.Get(streamErrorTrailer); trailer != "internal_error: Internal server error" {
+				t.Errorf("the %s trailer is %q", streamErrorTrailer, trailer)
+			}
+			test.check(t, w.Body.String())
+		})
+	}
+}
+
+func TestStreamSongsFirstRowError(t *testing.T){
+	rows := &failingRows{cachedRows: &cachedRows{index: -1}, err: errors.New("database is locked")}
+
+	w := httptest.NewRecorder()
+	streamSongs(w, httptest.NewRequest("GET", "/songs?format=ndjson", nil), rows, 0, listOptions{Limit: 10})
+	response := w.Result()
+
+	//Nothing was sent yet, so the error has its own status and no trailer
+	if response.StatusCode != http.StatusInternalServerError || response.Trailer.Get(streamErrorTrailer) != "" {
+		t.Errorf("the status is %d and the trailer %q, 500 without a trailer expected", response.StatusCode, response.Trailer.Get(streamErrorTrailer))
+	}
+}
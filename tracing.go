@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"net/http"
+	"golang.org/x/net/trace"
+)
+
+/* Constants */
+
+//Header of the W3C Trace Context that identifies the trace and the caller of a request
+const traceparentHeader = "traceparent"
+
+//Format of the traceparent header: version-traceID-parentID-flags, in lower case hexadecimal
+var traceparentFormat = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+//Flags of the traces started by the server, which are sampled
+const sampledTraceFlags = "01"
+
+/* Types */
+
+//traceContext identifies the trace of a request and the span of the server in it
+type traceContext struct{
+	TraceID string
+	ParentID string
+	SpanID string
+	Flags string
+}
+
+//traceparent gives the traceparent header of the span of the server, to be echoed to the caller
+func (current traceContext) traceparent() string{
+	return "00-" + current.TraceID + "-" + current.SpanID + "-" + current.Flags
+}
+
+/* Event Log */
+
+//databaseEvents records the events of the database pool, which are shown in /debug/events
+var databaseEvents trace.EventLog
+
+/* Middleware */
+
+//traceRequests wraps each request in a trace that is shown in /debug/requests, grouped by method and route pattern.
+//The trace continues the one given by the caller in the traceparent header, and the span of the server is echoed in the response
+func traceRequests(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		current := newTraceContext(r.Header.Get(traceparentHeader))
+		w.Header().Set(traceparentHeader, current.traceparent())
+
+		requestTrace := trace.New(r.Method + " " + matchedPattern(r), r.URL.Path)
+		defer requestTrace.Finish()
+
+		//SetTraceInfo takes numbers, the low half of the trace ID is enough to find the trace
+		traceID, _ := strconv.ParseUint(current.TraceID[16:], 16, 64)
+		spanID, _ := strconv.ParseUint(current.SpanID, 16, 64)
+		requestTrace.SetTraceInfo(traceID, spanID)
+
+		requestTrace.LazyPrintf("trace %s, parent span %s, span %s", current.TraceID, current.ParentID, current.SpanID)
+		requestTrace.LazyPrintf("%s %s from %s", r.Method, r.URL.RequestURI(), r.RemoteAddr)
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(trace.NewContext(r.Context(), requestTrace)))
+
+		if recorder.Status == 0 {
+			recorder.Status = http.StatusOK
+		}
+		requestTrace.LazyPrintf("status %d, %d bytes", recorder.Status, recorder.Bytes)
+		if recorder.Status >= http.StatusInternalServerError {
+			requestTrace.SetError()
+		}
+	})
+}
+
+/* Tracing Functions */
+
+//newTraceContext continues the trace of the given traceparent header with a new span,
+//or starts a new trace when the header is missing or not valid
+func newTraceContext(header string) traceContext{
+	current := traceContext{SpanID: randomHex(8)}
+
+	parts := traceparentFormat.FindStringSubmatch(header)
+	if parts != nil && parts[1] != "ff" && parts[2] != "00000000000000000000000000000000" && parts[3] != "0000000000000000" {
+		current.TraceID, current.ParentID, current.Flags = parts[2], parts[3], parts[4]
+		return current
+	}
+
+	current.TraceID = randomHex(16)
+	current.Flags = sampledTraceFlags
+	return current
+}
+
+//traceEvent adds an event to the trace of the request that the given context belongs to, if it has one
+func traceEvent(ctx context.Context, format string, values ...interface{}){
+	if requestTrace, hasTrace := trace.FromContext(ctx); hasTrace {
+		requestTrace.LazyPrintf(format, values...)
+	}
+}
+
+//traceQueryError adds the error of a sql statement to the trace of the request that the given context belongs to,
+//and to the database events
+func traceQueryError(ctx context.Context, sqlStatement string, queryError error){
+	if requestTrace, hasTrace := trace.FromContext(ctx); hasTrace {
+		requestTrace.LazyPrintf("failed %s: %v", describeStatement(sqlStatement), queryError)
+		requestTrace.SetError()
+	}
+	if databaseEvents != nil {
+		databaseEvents.Errorf("failed %s: %v", describeStatement(sqlStatement), queryError)
+	}
+}
+
+//randomHex gives a random number of the given size in bytes in lower case hexadecimal
+func randomHex(size int) string{
+	randomBytes := make([]byte, size)
+	rand.Read(randomBytes)
+
+	return hex.EncodeToString(randomBytes)
+}
+
+//debugTraces serves the /debug/requests and /debug/events pages of golang.org/x/net/trace,
+//which only answer the requests made from the same host
+func debugTraces(w http.ResponseWriter, r *http.Request){
+	http.DefaultServeMux.ServeHTTP(w, r)
+}
+
+//describeStatement shortens a sql statement to be shown in a trace
+func describeStatement(sqlStatement string) string{
+	if len(sqlStatement) > 120 {
+		return fmt.Sprintf("%s... (%d characters)", sqlStatement[:120], len(sqlStatement))
+	}
+	return sqlStatement
+}